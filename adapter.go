@@ -2,6 +2,7 @@ package casbinbunadapter
 
 import (
 	"context"
+	"time"
 
 	"github.com/casbin/casbin/v2/model"
 	"github.com/pkg/errors"
@@ -13,27 +14,109 @@ type BunAdapter struct {
 	*bun.DB
 	matcher MatcherOptions
 	trigger TriggerOptions
+	// Version of the latest change committed via this adapter
+	written *versionTracker
+	// Version of the latest change applied by updates listener
+	applied *versionTracker
+	// Name of the revision table bumped by every write. Empty string means that revision is not tracked
+	revisionTable string
+	// If column mapping needed to be detected by OpenBunAdapter(). See WithDetectedColumns()
+	detectColumns bool
+	// Storage conventions of other adapter. See WithGormCompatibility() and WithXormCompatibility()
+	compat compatibility
+	// If MatcherOptions.TableName has been set by caller. Compatibility presets do not replace it then
+	explicitTable bool
+	// Value of MatcherOptions.Tenant column scoping every query. See WithTenant()
+	tenant string
+	// Resolver of the policy table for *Ctx methods. See WithSchemaResolver()
+	routing *schemaRouting
+	// Name of session setting holding tenant for row-level security. See WithRLSSetting()
+	rlsSetting string
+	// Name of the history table recording every change. Empty string means that history is not recorded
+	historyTable string
+	// Metadata used when context has no one. See WithDefaultChangeMetadata()
+	defaultMetadata ChangeMetadata
+	// Name of the table holding named snapshots of the policy. Empty string means that snapshots are disabled
+	snapshotTable string
+	// If names were checked for PostgreSQL length limit. See WithIdentifierLengthCheck()
+	checkLength bool
+	// Error of options found by Validate() on construction. It is returned by every method which accesses the policy table
+	invalid error
 }
 
-// NewBunAdapter returns new *BunAdapter. Connections to database must be provided. Other arguments are optional
+// NewBunAdapter returns new *BunAdapter. Connections to database must be provided. Other arguments are optional.
+// Options are validated (see Validate()) and invalid ones are reported by every method which accesses the policy table
 func NewBunAdapter(bunConnection *bun.DB, opts ...func(*BunAdapter)) *BunAdapter {
 	defaultMatcher := defaultMatcherOpts
 	defaultTrigger := defaultTriggerOpts
-	a := &BunAdapter{bunConnection, defaultMatcher, defaultTrigger}
+	a := &BunAdapter{
+		DB:      bunConnection,
+		matcher: defaultMatcher,
+		trigger: defaultTrigger,
+		written: newVersionTracker(),
+		applied: newVersionTracker(),
+	}
 	for _, opt := range opts {
 		opt(a)
 	}
+	a.invalid = a.Validate()
+	if a.invalid == nil && a.detectColumns {
+		a.invalid = errors.Wrap(ErrColumnDetection, "columns are detected by OpenBunAdapter() only")
+	}
 	return a
 }
 
+// OpenBunAdapter returns new *BunAdapter same as NewBunAdapter does, but returns error of invalid options (see Validate()) instead of deferring it.
+// Options which need database (WithDetectedColumns) are applied here too
+func OpenBunAdapter(bunConnection *bun.DB, opts ...func(*BunAdapter)) (*BunAdapter, error) {
+	a := NewBunAdapter(bunConnection, opts...)
+	if a.detectColumns {
+		err := a.detectMatcher(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		a.invalid = a.Validate()
+	}
+	err := a.checkOptions()
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
 // LoadPolicy loads all policy rules from the storage
 func (a *BunAdapter) LoadPolicy(model model.Model) error {
-	var data []CasbinPolicy
-	ctx := context.Background()
-	query := a.NewSelect().
-		Model(&data).
-		ModelTableExpr("?.? as t", bun.Name(a.matcher.SchemaName), bun.Name(a.matcher.TableName)).
-		ColumnExpr("? as id", bun.Name(a.matcher.ID)).
+	return a.LoadPolicyCtx(context.Background(), model)
+}
+
+// LoadPolicyCtx loads all policy rules from the storage. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) LoadPolicyCtx(ctx context.Context, model model.Model) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := a.readPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range data {
+		row := data[i]
+		err = loadSinglePolicy(row, a.ruleDefinition(row), model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// policyColumns selects user defined columns as canonical ones
+func (a *BunAdapter) policyColumns(query *bun.SelectQuery) *bun.SelectQuery {
+	if a.compat.withoutID {
+		query = query.ColumnExpr("0 as id")
+	} else {
+		query = query.ColumnExpr("? as id", bun.Name(a.matcher.ID))
+	}
+	return query.
 		ColumnExpr("? as ptype", bun.Name(a.matcher.PType)).
 		ColumnExpr("? as v0", bun.Name(a.matcher.V0)).
 		ColumnExpr("? as v1", bun.Name(a.matcher.V1)).
@@ -41,22 +124,41 @@ func (a *BunAdapter) LoadPolicy(model model.Model) error {
 		ColumnExpr("? as v3", bun.Name(a.matcher.V3)).
 		ColumnExpr("? as v4", bun.Name(a.matcher.V4)).
 		ColumnExpr("? as v5", bun.Name(a.matcher.V5))
+}
+
+// selectPolicies reads all rows (except soft-deleted ones) of the policy table mapping user defined columns to canonical ones
+func (a *BunAdapter) selectPolicies(ctx context.Context, db bun.IDB) ([]CasbinPolicy, error) {
+	return a.selectPoliciesWhere(ctx, db, nil)
+}
+
+// selectPoliciesWhere reads rows of the policy table matching the filter. Nil filter means all rows. Soft-deleted rows are skipped
+func (a *BunAdapter) selectPoliciesWhere(ctx context.Context, db bun.IDB, filter func(bun.QueryBuilder) bun.QueryBuilder) ([]CasbinPolicy, error) {
+	return a.selectRows(ctx, db, a.scopeLive, filter)
+}
+
+// selectRows reads rows of current tenant matching every filter. Nil filters are skipped
+func (a *BunAdapter) selectRows(ctx context.Context, db bun.IDB, filters ...func(bun.QueryBuilder) bun.QueryBuilder) ([]CasbinPolicy, error) {
+	var data []CasbinPolicy
+	query := a.policyColumns(db.NewSelect().
+		Model(&data).
+		ModelTableExpr("? as t", a.policyTable()))
+	query = query.ApplyQueryBuilder(a.scopeTenant)
+	for _, filter := range filters {
+		if filter != nil {
+			query = query.ApplyQueryBuilder(filter)
+		}
+	}
 	err := query.Scan(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for i := range data {
-		row := data[i]
-		err = loadSinglePolicy(row, model)
-		if err != nil {
-			return err
-		}
+		data[i].Tenant = a.tenant
 	}
-	return nil
+	return data, nil
 }
 
-func loadSinglePolicy(policy CasbinPolicy, model model.Model) error {
-	ruleDef := policy.getRuleDefinition()
+func loadSinglePolicy(policy CasbinPolicy, ruleDef []string, model model.Model) error {
 	found, err := model.HasPolicyEx(policy.PType[:1], policy.PType, ruleDef)
 	if err != nil {
 		return errors.Wrapf(err, "Can't validate single policy. Policy: '%+v'", policy)
@@ -74,6 +176,15 @@ func loadSinglePolicy(policy CasbinPolicy, model model.Model) error {
 
 // SavePolicy saves all policy rules to the storage
 func (a *BunAdapter) SavePolicy(model model.Model) error {
+	return a.SavePolicyCtx(context.Background(), model)
+}
+
+// SavePolicyCtx saves all policy rules to the storage. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) SavePolicyCtx(ctx context.Context, model model.Model) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
 	policies := []CasbinPolicy{}
 
 	/* Collect policies and rules */
@@ -94,22 +205,30 @@ func (a *BunAdapter) SavePolicy(model model.Model) error {
 	}
 
 	/* Update table data */
-	err := a.savePoliciesToDB(policies)
+	err = a.savePoliciesToDB(ctx, policies)
 	if err != nil {
 		return errors.Wrap(err, "Can't save policies to the database")
 	}
 	return nil
 }
 
-func (a *BunAdapter) savePoliciesToDB(policies []CasbinPolicy) error {
-	ctx := context.Background()
+func (a *BunAdapter) savePoliciesToDB(ctx context.Context, policies []CasbinPolicy) error {
 	// We should run it in transaction since potential INSERT operation problem
-	err := a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+	err := a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		if a.hasValidity() || a.softDelete() {
+			return a.savePoliciesIncrementally(ctx, tx, policies)
+		}
+		/* Remember previous state for history */
+		var previous []CasbinPolicy
+		if a.historyTable != "" {
+			var err error
+			previous, err = a.selectPolicies(ctx, tx)
+			if err != nil {
+				return err
+			}
+		}
 		/* Clean table first */
-		truncateQuery := tx.NewTruncateTable().
-			ModelTableExpr("?.?", bun.Name(a.matcher.SchemaName), bun.Name(a.matcher.TableName)).
-			Model((*CasbinPolicy)(nil))
-		_, err := truncateQuery.Exec(ctx)
+		err := a.clearPolicies(ctx, tx)
 		if err != nil {
 			return err
 		}
@@ -117,73 +236,218 @@ func (a *BunAdapter) savePoliciesToDB(policies []CasbinPolicy) error {
 		// Since it is hard to change column name, just insert it a loop instead of bulk insert
 		for i := range policies {
 			policy := policies[i]
-			// https://bun.uptrace.dev/guide/query-insert.html#maps
-			values := map[string]interface{}{
-				a.matcher.PType: policy.PType,
-				a.matcher.V0:    policy.V0,
-				a.matcher.V1:    policy.V1,
-				a.matcher.V2:    policy.V2,
-				a.matcher.V3:    policy.V3,
-				a.matcher.V4:    policy.V4,
-				a.matcher.V5:    policy.V5,
-			}
+			values := a.insertValues(ctx, policy)
 			query := tx.NewInsert().
-				ModelTableExpr("?.?", bun.Name(a.matcher.SchemaName), bun.Name(a.matcher.TableName)).
+				ModelTableExpr("?", a.policyTable()).
 				Model(&values)
-			_, err = query.Exec(ctx)
+			res, err := query.Exec(ctx)
 			if err != nil {
 				return errors.Wrapf(err, "Can't insert single policy. Policy: %+v", policy)
 			}
+			err = countChanges(ctx, res)
+			if err != nil {
+				return err
+			}
 		}
-		return nil
+		return a.recordStateChange(ctx, tx, previous, policies)
 	})
 	return err
 }
 
+// policyValues maps policy to user defined columns for inserting. See https://bun.uptrace.dev/guide/query-insert.html#maps
+func (a *BunAdapter) policyValues(policy CasbinPolicy) map[string]interface{} {
+	values := map[string]interface{}{
+		a.matcher.PType: policy.PType,
+		a.matcher.V0:    policy.V0,
+		a.matcher.V1:    policy.V1,
+		a.matcher.V2:    policy.V2,
+		a.matcher.V3:    policy.V3,
+		a.matcher.V4:    policy.V4,
+		a.matcher.V5:    policy.V5,
+	}
+	if a.matcher.Tenant != "" {
+		values[a.matcher.Tenant] = a.tenant
+	}
+	return values
+}
+
+// insertValues returns values of inserted row: policy, metadata (see WithChangeMetadata()) and timestamps
+func (a *BunAdapter) insertValues(ctx context.Context, policy CasbinPolicy) map[string]interface{} {
+	values := a.applyMetadataColumns(ctx, a.policyValues(policy), true)
+	return a.applyTimestampColumns(values, time.Now().UTC(), true)
+}
+
+// updateValues returns values of updated row. Columns describing insertion (MatcherOptions.CreatedBy and CreatedAt) are not changed
+func (a *BunAdapter) updateValues(ctx context.Context, policy CasbinPolicy) map[string]interface{} {
+	values := a.applyMetadataColumns(ctx, a.policyValues(policy), false)
+	return a.applyTimestampColumns(values, time.Now().UTC(), false)
+}
+
 // AddPolicy adds a policy rule to the storage. Needed for AutoSave, see the ref. https://casbin.org/docs/adapters/#autosave
 func (a *BunAdapter) AddPolicy(sec string, ptype string, rule []string) error {
-	ctx := context.Background()
-	newPolicy := NewCasbinPolicyFrom(ptype, rule)
-	values := map[string]interface{}{
-		a.matcher.PType: newPolicy.PType,
-		a.matcher.V0:    newPolicy.V0,
-		a.matcher.V1:    newPolicy.V1,
-		a.matcher.V2:    newPolicy.V2,
-		a.matcher.V3:    newPolicy.V3,
-		a.matcher.V4:    newPolicy.V4,
-		a.matcher.V5:    newPolicy.V5,
-	}
-	query := a.DB.NewInsert().
-		ModelTableExpr("?.?", bun.Name(a.matcher.SchemaName), bun.Name(a.matcher.TableName)).
-		On("CONFLICT (?, ?, ?, ?, ?, ?, ?) DO NOTHING", bun.Name(a.matcher.PType), bun.Name(a.matcher.V0), bun.Name(a.matcher.V1), bun.Name(a.matcher.V2), bun.Name(a.matcher.V3), bun.Name(a.matcher.V4), bun.Name(a.matcher.V5)).
-		Model(&values)
-	_, err := query.Exec(ctx)
-	return err
+	return a.AddPolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// AddPolicyCtx adds a policy rule to the storage. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) AddPolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	policy := NewCasbinPolicyFrom(ptype, rule)
+	values := a.insertValues(ctx, policy)
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		inserted, err := a.insertPolicyIgnoringDuplicates(ctx, tx, values)
+		if err != nil || !inserted {
+			return err
+		}
+		return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, []CasbinPolicy{policy})
+	})
 }
 
 // RemovePolicy removes a policy rule from the storage. Needed for AutoSave, see the ref. https://casbin.org/docs/adapters/#autosave
 func (a *BunAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
-	ctx := context.Background()
+	return a.RemovePolicyCtx(context.Background(), sec, ptype, rule)
+}
+
+// RemovePolicyCtx removes a policy rule from the storage. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) RemovePolicyCtx(ctx context.Context, sec string, ptype string, rule []string) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
 	obsoletePolicy := NewCasbinPolicyFrom(ptype, rule)
-	query := a.DB.NewDelete().
-		ModelTableExpr("?.?", bun.Name(a.matcher.SchemaName), bun.Name(a.matcher.TableName)).
-		Where("? = ?", bun.Name(a.matcher.PType), obsoletePolicy.PType).
-		Where("? = ?", bun.Name(a.matcher.V0), obsoletePolicy.V0).
-		Where("? = ?", bun.Name(a.matcher.V1), obsoletePolicy.V1).
-		Where("? = ?", bun.Name(a.matcher.V2), obsoletePolicy.V2).
-		Where("? = ?", bun.Name(a.matcher.V3), obsoletePolicy.V3).
-		Where("? = ?", bun.Name(a.matcher.V4), obsoletePolicy.V4).
-		Where("? = ?", bun.Name(a.matcher.V5), obsoletePolicy.V5)
-	_, err := query.Exec(ctx)
-	return err
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := a.deletePolicies(ctx, tx, a.policyFilter(obsoletePolicy), false)
+		return err
+	})
+}
+
+// AddPolicies adds policy rules to the storage. Needed for AutoSave of batch methods, see the ref. https://casbin.org/docs/adapters/#autosave
+func (a *BunAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return a.AddPoliciesCtx(context.Background(), sec, ptype, rules)
+}
+
+// AddPoliciesCtx adds policy rules to the storage within single transaction. Existing rules are skipped.
+// Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) AddPoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		inserted := make([]CasbinPolicy, 0, len(rules))
+		for _, rule := range rules {
+			policy := NewCasbinPolicyFrom(ptype, rule)
+			ok, err := a.insertPolicyIgnoringDuplicates(ctx, tx, a.insertValues(ctx, policy))
+			if err != nil {
+				return errors.Wrapf(err, "Can't insert single policy. Policy: %+v", policy)
+			}
+			if ok {
+				inserted = append(inserted, policy)
+			}
+		}
+		return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, inserted)
+	})
+}
+
+// RemovePolicies removes policy rules from the storage. Needed for AutoSave of batch methods, see the ref. https://casbin.org/docs/adapters/#autosave
+func (a *BunAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return a.RemovePoliciesCtx(context.Background(), sec, ptype, rules)
+}
+
+// RemovePoliciesCtx removes policy rules from the storage within single transaction. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) RemovePoliciesCtx(ctx context.Context, sec string, ptype string, rules [][]string) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		for _, rule := range rules {
+			_, err := a.deletePolicies(ctx, tx, a.policyFilter(NewCasbinPolicyFrom(ptype, rule)), false)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// policyFilter returns conditions matching exactly the policy
+func (a *BunAdapter) policyFilter(policy CasbinPolicy) func(bun.QueryBuilder) bun.QueryBuilder {
+	return func(query bun.QueryBuilder) bun.QueryBuilder {
+		return query.
+			Where("? = ?", bun.Name(a.matcher.PType), policy.PType).
+			Where("? = ?", bun.Name(a.matcher.V0), policy.V0).
+			Where("? = ?", bun.Name(a.matcher.V1), policy.V1).
+			Where("? = ?", bun.Name(a.matcher.V2), policy.V2).
+			Where("? = ?", bun.Name(a.matcher.V3), policy.V3).
+			Where("? = ?", bun.Name(a.matcher.V4), policy.V4).
+			Where("? = ?", bun.Name(a.matcher.V5), policy.V5)
+	}
+}
+
+// deletePolicies removes rows of current tenant matching the filter within the transaction.
+// Removed rows are recorded in history table (see WithHistoryTable()), so they are read before removal. They are returned when collect is true
+func (a *BunAdapter) deletePolicies(ctx context.Context, tx bun.Tx, filter func(bun.QueryBuilder) bun.QueryBuilder, collect bool) ([]CasbinPolicy, error) {
+	var removed []CasbinPolicy
+	if a.historyTable != "" || collect {
+		var err error
+		removed, err = a.selectPoliciesWhere(ctx, tx, filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := a.removeRows(ctx, tx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return removed, a.recordHistory(ctx, tx, POLICY_OPERATION_DELETE, removed)
+}
+
+// removeRows deletes rows of current tenant matching the filter. Rows are marked as deleted in soft-delete mode (see MatcherOptions.DeletedAt)
+func (a *BunAdapter) removeRows(ctx context.Context, tx bun.Tx, filter func(bun.QueryBuilder) bun.QueryBuilder) error {
+	if a.softDelete() {
+		return a.markDeleted(ctx, tx, filter)
+	}
+	res, err := tx.NewDelete().
+		ModelTableExpr("?", a.policyTable()).
+		ApplyQueryBuilder(filter).
+		ApplyQueryBuilder(a.scopeTenant).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return countChanges(ctx, res)
 }
 
 // RemoveFilteredPolicy removes policy rules that match the filter from the storage. Needed for AutoSave, see the ref. https://casbin.org/docs/adapters/#autosave
 func (a *BunAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
-	ctx := context.Background()
-	query := a.DB.NewDelete().
-		ModelTableExpr("?.?", bun.Name(a.matcher.SchemaName), bun.Name(a.matcher.TableName)).
-		Where("? = ?", bun.Name(a.matcher.PType), ptype)
+	return a.RemoveFilteredPolicyCtx(context.Background(), sec, ptype, fieldIndex, fieldValues...)
+}
+
+// RemoveFilteredPolicyCtx removes policy rules that match the filter from the storage. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) RemoveFilteredPolicyCtx(ctx context.Context, sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := a.deletePolicies(ctx, tx, a.fieldFilter(ptype, fieldIndex, fieldValues...), false)
+		return err
+	})
+}
+
+// fieldFilter returns conditions of RemoveFilteredPolicy(): policy type and every non-empty filter value
+func (a *BunAdapter) fieldFilter(ptype string, fieldIndex int, fieldValues ...string) func(bun.QueryBuilder) bun.QueryBuilder {
+	return func(query bun.QueryBuilder) bun.QueryBuilder {
+		query = query.Where("? = ?", bun.Name(a.matcher.PType), ptype)
+		return a.applyRuleFilter(query, fieldIndex, fieldValues...)
+	}
+}
+
+// applyRuleFilter adds conditions for every non-empty filter value
+func (a *BunAdapter) applyRuleFilter(query bun.QueryBuilder, fieldIndex int, fieldValues ...string) bun.QueryBuilder {
 	if v := extractRuleField(0, fieldIndex, fieldValues...); v != "" {
 		query = query.Where("? = ?", bun.Name(a.matcher.V0), v)
 	}
@@ -202,8 +466,7 @@ func (a *BunAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex i
 	if v := extractRuleField(5, fieldIndex, fieldValues...); v != "" {
 		query = query.Where("? = ?", bun.Name(a.matcher.V5), v)
 	}
-	_, err := query.Exec(ctx)
-	return err
+	return query
 }
 
 func extractRuleField(fieldArrayIdx, fieldIndex int, fieldValues ...string) string {
@@ -1,5 +1,9 @@
 package casbinbunadapter
 
+const (
+	defaultRevisionTable = "casbin_policy_revision"
+)
+
 var (
 	defaultMatcherOpts = MatcherOptions{
 		SchemaName: "public",
@@ -20,6 +24,7 @@ var (
 		FunctionReplace:    false,
 		TriggerReplace:     false,
 		ChannelName:        "CASBIN_UPDATE_MESSAGE",
+		VersionTableName:   "casbin_policy_version",
 	}
 )
 
@@ -27,11 +32,12 @@ var (
 func WithMatcherOptions(matcher MatcherOptions) func(*BunAdapter) {
 	return func(a *BunAdapter) {
 		a.matcher = matcher
+		a.explicitTable = matcher.TableName != ""
 		if a.matcher.SchemaName == "" {
 			a.matcher.SchemaName = defaultMatcherOpts.SchemaName
 		}
 		if a.matcher.TableName == "" {
-			a.matcher.TableName = defaultMatcherOpts.TableName
+			a.matcher.TableName = a.defaultTableName()
 		}
 		if a.matcher.ID == "" {
 			a.matcher.ID = defaultMatcherOpts.ID
@@ -76,5 +82,28 @@ func WithTriggerOptions(trigger TriggerOptions) func(*BunAdapter) {
 		if a.trigger.ChannelName == "" {
 			a.trigger.ChannelName = defaultTriggerOpts.ChannelName
 		}
+		if a.trigger.VersionTableName == "" {
+			a.trigger.VersionTableName = defaultTriggerOpts.VersionTableName
+		}
+	}
+}
+
+// WithIdentifierLengthCheck makes Validate() to report names which PostgreSQL would truncate to 63 bytes (including finalized
+// trigger name "$SCHEMA_NAME$_$TABLE_NAME$_$TRIGGER_NAME$"). It is opt-in since truncated names used to work as long as they were unique
+func WithIdentifierLengthCheck() func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.checkLength = true
+	}
+}
+
+// WithRevisionTable makes every write via adapter bump revision counter stored in the table located in MatcherOptions.SchemaName.
+// Revision is used by polling change source and it replaces trigger version in LastWrittenVersion(). Empty name means default one: "casbin_policy_revision".
+// Table must be created via CreateRevisionTable()
+func WithRevisionTable(tableName string) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.revisionTable = tableName
+		if a.revisionTable == "" {
+			a.revisionTable = defaultRevisionTable
+		}
 	}
 }
@@ -0,0 +1,176 @@
+package casbinbunadapter
+
+import (
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/pkg/errors"
+)
+
+// ListenOptions is for tuning the way updates listener applies change events to the enforcer
+type ListenOptions struct {
+	// Events received within this window (counting from the first event of the batch) are applied to the enforcer as single batch.
+	// Zero value means that every event is applied immediately
+	CoalesceWindow time.Duration
+	// If number of events in the batch exceeds this value then whole policy is reloaded instead of applying the batch.
+	// Zero value disables reloading. Works only along with CoalesceWindow
+	ReloadThreshold int
+}
+
+// WithCoalescing enables grouping of events received within the window. Grouped events are applied via AddPolicies/RemovePolicies-like calls
+func WithCoalescing(window time.Duration) func(*ListenOptions) {
+	return func(o *ListenOptions) {
+		o.CoalesceWindow = window
+	}
+}
+
+// WithReloadThreshold makes listener reload whole policy via LoadPolicy() when coalesced batch is bigger than threshold
+func WithReloadThreshold(threshold int) func(*ListenOptions) {
+	return func(o *ListenOptions) {
+		o.ReloadThreshold = threshold
+	}
+}
+
+// policyOperation is single add or remove operation on the enforcer
+type policyOperation struct {
+	add   bool
+	ptype string
+	rule  []string
+}
+
+// coalescedBatch accumulates change events and applies them to the enforcer in a few batch calls
+type coalescedBatch struct {
+	// Converts stored policy into Casbin rule. See BunAdapter.ruleDefinition()
+	ruleDefinition func(CasbinPolicy) []string
+	events         []TriggerDataPayload
+	maxVersion     int64
+	// If batch contains RELOAD event
+	reload bool
+}
+
+func (b *coalescedBatch) push(payload TriggerDataPayload) {
+	b.events = append(b.events, payload)
+	if payload.EventType == EVENT_PAYLOAD_RELOAD {
+		b.reload = true
+	}
+	if payload.Version > b.maxVersion {
+		b.maxVersion = payload.Version
+	}
+}
+
+func (b *coalescedBatch) reset() {
+	b.events = b.events[:0]
+	b.maxVersion = 0
+	b.reload = false
+}
+
+// operations converts events into ordered list of operations. UPDATE event becomes removing of the old policy followed by adding of the new one
+func (b *coalescedBatch) operations() []policyOperation {
+	ops := make([]policyOperation, 0, len(b.events))
+	for _, payload := range b.events {
+		switch payload.EventType {
+		case EVENT_PAYLOAD_INSERT:
+			ops = append(ops, policyOperation{add: true, ptype: payload.New.PType, rule: b.ruleDefinition(payload.New)})
+		case EVENT_PAYLOAD_UPDATE:
+			ops = append(ops, policyOperation{add: false, ptype: payload.Old.PType, rule: b.ruleDefinition(payload.Old)})
+			ops = append(ops, policyOperation{add: true, ptype: payload.New.PType, rule: b.ruleDefinition(payload.New)})
+		case EVENT_PAYLOAD_DELETE:
+			ops = append(ops, policyOperation{add: false, ptype: payload.Old.PType, rule: b.ruleDefinition(payload.Old)})
+		}
+	}
+	return ops
+}
+
+// apply applies accumulated events to the enforcer. Consecutive operations of the same kind and policy type are applied via single call.
+// Whole policy is reloaded instead if batch contains RELOAD event
+func (b *coalescedBatch) apply(enforcer *casbin.SyncedEnforcer, reloadThreshold int) error {
+	if len(b.events) == 0 {
+		return nil
+	}
+	if b.reload || (reloadThreshold > 0 && len(b.events) > reloadThreshold) {
+		err := enforcer.LoadPolicy()
+		if err != nil {
+			return errors.Wrapf(err, "Can't reload policy for batch of %d events", len(b.events))
+		}
+		return nil
+	}
+	ops := b.operations()
+	for start := 0; start < len(ops); {
+		end := start + 1
+		for end < len(ops) && ops[end].add == ops[start].add && ops[end].ptype == ops[start].ptype {
+			end++
+		}
+		rules := make([][]string, 0, end-start)
+		for _, op := range ops[start:end] {
+			rules = append(rules, op.rule)
+		}
+		err := applyPolicyOperations(enforcer, ops[start].add, ops[start].ptype, rules)
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+func applyPolicyOperations(enforcer *casbin.SyncedEnforcer, add bool, ptype string, rules [][]string) error {
+	var err error
+	switch {
+	case add && ptype[:1] == "p":
+		_, err = enforcer.AddNamedPoliciesEx(ptype, rules)
+	case add && ptype[:1] == "g":
+		_, err = enforcer.AddNamedGroupingPoliciesEx(ptype, rules)
+	case !add && ptype[:1] == "p":
+		_, err = enforcer.RemoveNamedPolicies(ptype, rules)
+	case !add && ptype[:1] == "g":
+		_, err = enforcer.RemoveNamedGroupingPolicies(ptype, rules)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Can't apply batch of %d rules. Policy type is: '%s'. Adding: %t", len(rules), ptype, add)
+	}
+	return nil
+}
+
+// applyCoalesced groups events received within the window and applies them as single batch
+func (a *BunAdapter) applyCoalesced(enforcer *casbin.SyncedEnforcer, events <-chan TriggerDataPayload, listenOpts ListenOptions) error {
+	batch := coalescedBatch{ruleDefinition: a.ruleDefinition}
+	flush := func() error {
+		err := batch.apply(enforcer, listenOpts.ReloadThreshold)
+		if err != nil {
+			return err
+		}
+		a.applied.advance(batch.maxVersion)
+		batch.reset()
+		return nil
+	}
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case payloadData, ok := <-events:
+			if !ok {
+				return flush()
+			}
+			payloadData, owned := a.scopePayload(payloadData)
+			if !owned {
+				continue
+			}
+			batch.push(payloadData)
+			if timerC == nil {
+				timer = time.NewTimer(listenOpts.CoalesceWindow)
+				timerC = timer.C
+			}
+		case <-timerC:
+			timerC = nil
+			err := flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRBACModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`
+
+func newTestEnforcer(t *testing.T) *casbin.SyncedEnforcer {
+	m, err := model.NewModelFromString(testRBACModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer, err := casbin.NewSyncedEnforcer(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enforcer
+}
+
+// go test -run '^TestCoalescedBatch$' *.go -v
+func TestCoalescedBatch(t *testing.T) {
+	enforcer := newTestEnforcer(t)
+	batch := coalescedBatch{ruleDefinition: CasbinPolicy.getRuleDefinition}
+	batch.push(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, Version: 1, New: NewCasbinPolicyFrom("p", []string{"alice", "data1", "read", "allow"})})
+	batch.push(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, Version: 2, New: NewCasbinPolicyFrom("p", []string{"bob", "data2", "write", "allow"})})
+	batch.push(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, Version: 3, New: NewCasbinPolicyFrom("g", []string{"alice", "admin"})})
+	batch.push(TriggerDataPayload{
+		EventType: EVENT_PAYLOAD_UPDATE,
+		Version:   5,
+		Old:       NewCasbinPolicyFrom("p", []string{"bob", "data2", "write", "allow"}),
+		New:       NewCasbinPolicyFrom("p", []string{"bob", "data2", "write", "deny"}),
+	})
+	batch.push(TriggerDataPayload{EventType: EVENT_PAYLOAD_DELETE, Version: 4, Old: NewCasbinPolicyFrom("p", []string{"alice", "data1", "read", "allow"})})
+	assert.Equal(t, int64(5), batch.maxVersion)
+	assert.Len(t, batch.operations(), 6)
+
+	err := batch.apply(enforcer, 0)
+	assert.NoError(t, err)
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "data2", "write", "deny"}}, policies)
+	groupings, err := enforcer.GetGroupingPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "admin"}}, groupings)
+
+	batch.reset()
+	assert.Len(t, batch.events, 0)
+	assert.Equal(t, int64(0), batch.maxVersion)
+}
+
+// chanSource is change source forwarding events of the channel
+type chanSource struct {
+	events chan TriggerDataPayload
+}
+
+func (src *chanSource) Run(ctx context.Context, events chan<- TriggerDataPayload) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case payload, ok := <-src.events:
+			if !ok {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case events <- payload:
+			}
+		}
+	}
+}
+
+// go test -run '^TestCoalescedListening$' *.go -v
+func TestCoalescedListening(t *testing.T) {
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "coalesced_policies"}))
+	m, err := model.NewModelFromString(testRBACModel)
+	assert.NoError(t, err)
+	// AutoSave is enabled by default, so batch calls go to the adapter
+	enforcer, err := casbin.NewSyncedEnforcer(m, adapter)
+	assert.NoError(t, err)
+	var _ persist.BatchAdapter = adapter
+
+	src := &chanSource{events: make(chan TriggerDataPayload)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- adapter.StartChangesListening(ctx, src, enforcer, WithCoalescing(200*time.Millisecond))
+	}()
+	src.events <- insertPayload(1, "p", "alice", "data1", "read", "allow")
+	src.events <- insertPayload(2, "p", "bob", "data2", "write", "allow")
+	src.events <- TriggerDataPayload{EventType: EVENT_PAYLOAD_DELETE, Version: 3, Old: NewCasbinPolicyFrom("p", []string{"alice", "data1", "read", "allow"})}
+	// Nothing is applied until the window is over
+	assert.Equal(t, int64(0), adapter.AppliedVersion())
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Second)
+	defer waitCancel()
+	assert.NoError(t, adapter.WaitForVersion(waitCtx, 3))
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "data2", "write", "allow"}}, policies)
+
+	/* Next batch is started by the next event */
+	src.events <- insertPayload(4, "g", "bob", "admin")
+	assert.NoError(t, adapter.WaitForVersion(waitCtx, 4))
+	groupings, err := enforcer.GetGroupingPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "admin"}}, groupings)
+
+	/* Pending batch is flushed when source stops */
+	src.events <- insertPayload(5, "p", "carol", "data1", "read", "allow")
+	close(src.events)
+	assert.NoError(t, <-listenErr)
+	assert.Equal(t, int64(5), adapter.AppliedVersion())
+}
+
+// go test -run '^TestReloadThreshold$' *.go -v
+func TestReloadThreshold(t *testing.T) {
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "threshold_policies"}))
+	m, err := model.NewModelFromString(testRBACModel)
+	assert.NoError(t, err)
+	enforcer, err := casbin.NewSyncedEnforcer(m, adapter)
+	assert.NoError(t, err)
+	enforcer.EnableAutoSave(false)
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+
+	src := &chanSource{events: make(chan TriggerDataPayload)}
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- adapter.StartChangesListening(context.Background(), src, enforcer, WithCoalescing(time.Hour), WithReloadThreshold(2))
+	}()
+	/* Small batch is applied as is */
+	src.events <- insertPayload(1, "p", "bob", "data2", "write", "allow")
+	src.events <- insertPayload(2, "p", "carol", "data2", "write", "allow")
+	close(src.events)
+	assert.NoError(t, <-listenErr)
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"bob", "data2", "write", "allow"}, {"carol", "data2", "write", "allow"}}, policies)
+
+	/* Bigger batch is replaced with reloading of policy from the table */
+	src = &chanSource{events: make(chan TriggerDataPayload)}
+	go func() {
+		listenErr <- adapter.StartChangesListening(context.Background(), src, enforcer, WithCoalescing(time.Hour), WithReloadThreshold(2))
+	}()
+	for version := int64(3); version <= 5; version++ {
+		src.events <- insertPayload(version, "p", "dave", "data3", "read", "allow")
+	}
+	close(src.events)
+	assert.NoError(t, <-listenErr)
+	policies, err = enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "data1", "read", "allow"}}, policies)
+	assert.Equal(t, int64(5), adapter.AppliedVersion())
+}
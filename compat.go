@@ -0,0 +1,194 @@
+package casbinbunadapter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	// compatTableName is default table name of gorm-adapter and xorm-adapter
+	compatTableName = "casbin_rule"
+)
+
+// compatibility describes storage conventions of other Casbin adapters sharing the same table. Zero value means conventions of this adapter
+type compatibility struct {
+	// Name of the adapter which conventions are followed
+	adapter string
+	// Size of varchar columns created by CreateTable()
+	columnSize int
+	// If table has no ID column. Zero is used as ID of loaded policies
+	withoutID bool
+	// If value columns are NOT NULL with empty string as default
+	notNullValues bool
+	// If unique constraint over ptype and value columns is created by CreateTable()
+	uniqueRule bool
+	// If empty values between non-empty ones are kept while loading policies. Otherwise every empty value is skipped
+	keepInnerEmptyValues bool
+}
+
+func (c compatibility) enabled() bool {
+	return c.adapter != ""
+}
+
+// WithGormCompatibility makes adapter to read and write table of gorm-adapter (https://github.com/casbin/gorm-adapter) same way as it does:
+// default table is "casbin_rule", CreateTable() creates varchar(100) columns with unique index over ptype and value columns,
+// empty values are stored as empty strings and only trailing empty values are skipped while loading policies.
+// Duplicates are skipped by AddPolicy() via "INSERT ... WHERE NOT EXISTS", so table without unique index works too
+func WithGormCompatibility() func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.compat = compatibility{
+			adapter:              "gorm-adapter",
+			columnSize:           100,
+			uniqueRule:           true,
+			keepInnerEmptyValues: true,
+		}
+		if !a.explicitTable {
+			a.matcher.TableName = compatTableName
+		}
+	}
+}
+
+// WithXormCompatibility makes adapter to read and write table of xorm-adapter (https://github.com/casbin/xorm-adapter) same way as it does:
+// default table is "casbin_rule" without ID column (MatcherOptions.ID is ignored), CreateTable() creates NOT NULL varchar(100) columns
+// with empty string as default and only trailing empty values are skipped while loading policies (same as gorm-adapter does).
+// Duplicates are skipped by AddPolicy() via "INSERT ... WHERE NOT EXISTS" since xorm-adapter does not create unique index
+func WithXormCompatibility() func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.compat = compatibility{
+			adapter:              "xorm-adapter",
+			columnSize:           100,
+			withoutID:            true,
+			notNullValues:        true,
+			keepInnerEmptyValues: true,
+		}
+		if !a.explicitTable {
+			a.matcher.TableName = compatTableName
+		}
+	}
+}
+
+// defaultTableName returns table name used when MatcherOptions.TableName is empty
+func (a *BunAdapter) defaultTableName() string {
+	if a.compat.enabled() {
+		return compatTableName
+	}
+	return defaultMatcherOpts.TableName
+}
+
+// ruleDefinition converts stored policy into Casbin rule following conventions of the adapter
+func (a *BunAdapter) ruleDefinition(policy CasbinPolicy) []string {
+	if !a.compat.keepInnerEmptyValues {
+		return policy.getRuleDefinition()
+	}
+	rule := []string{policy.V0, policy.V1, policy.V2, policy.V3, policy.V4, policy.V5}
+	last := len(rule)
+	for last > 0 && rule[last-1] == "" {
+		last--
+	}
+	return rule[:last]
+}
+
+// newNotExistsInsert prepares "INSERT ... SELECT ... WHERE NOT EXISTS" statement. It does not require unique constraint
+func (a *BunAdapter) newNotExistsInsert(db bun.IDB, values map[string]interface{}) *bun.RawQuery {
+	columns := a.ruleColumns()
+	insertColumns := make([]string, 0, len(columns))
+	insertColumnArgs := []interface{}{}
+	insertValues := make([]string, 0, len(columns))
+	insertValueArgs := []interface{}{}
+	conditions := make([]string, 0, len(columns))
+	conditionArgs := []interface{}{}
+	for _, column := range a.insertedColumns(values) {
+		insertColumns = append(insertColumns, "?")
+		insertColumnArgs = append(insertColumnArgs, bun.Name(column))
+		insertValues = append(insertValues, "?")
+		insertValueArgs = append(insertValueArgs, values[column])
+	}
+	for _, column := range columns {
+		value, ok := values[column]
+		if !ok {
+			continue
+		}
+		conditions = append(conditions, "? = ?")
+		conditionArgs = append(conditionArgs, bun.Name(column), value)
+	}
+	from := ""
+	if a.dialectName() == dialect.MySQL {
+		from = " FROM DUAL"
+	}
+	query := fmt.Sprintf(
+		"INSERT INTO ? (%s) SELECT %s%s WHERE NOT EXISTS (SELECT 1 FROM ? WHERE %s)",
+		strings.Join(insertColumns, ", "), strings.Join(insertValues, ", "), from, strings.Join(conditions, " AND "),
+	)
+	args := []interface{}{a.policyTable()}
+	args = append(args, insertColumnArgs...)
+	args = append(args, insertValueArgs...)
+	args = append(args, a.policyTable())
+	args = append(args, conditionArgs...)
+	return db.NewRaw(query, args...)
+}
+
+// compatTableSQL returns DDL of the policy table following conventions of other adapter
+func (a *BunAdapter) compatTableSQL() (string, error) {
+	var idDDL string
+	valueType := fmt.Sprintf("varchar(%d)", a.compat.columnSize)
+	switch a.dialectName() {
+	case dialect.PG:
+		idDDL = "int8 GENERATED BY DEFAULT AS IDENTITY NOT NULL"
+	case dialect.SQLite:
+		idDDL = "INTEGER PRIMARY KEY AUTOINCREMENT"
+	case dialect.MySQL:
+		idDDL = "bigint unsigned NOT NULL AUTO_INCREMENT"
+	case dialect.MSSQL:
+		idDDL = "bigint IDENTITY(1,1) NOT NULL"
+		valueType = "n" + valueType
+	default:
+		return "", a.requireDialect("Table creation", dialect.PG, dialect.SQLite, dialect.MySQL, dialect.MSSQL)
+	}
+	nullability := "NULL"
+	if a.compat.notNullValues {
+		nullability = "NOT NULL DEFAULT ''"
+	}
+	lines := []string{}
+	args := []interface{}{}
+	if !a.compat.withoutID {
+		lines = append(lines, "? "+idDDL)
+		args = append(args, bun.Name(a.matcher.ID))
+	}
+	if a.matcher.Tenant != "" {
+		lines = append(lines, "? "+valueType+" NOT NULL")
+		args = append(args, bun.Name(a.matcher.Tenant))
+	}
+	for _, column := range []string{a.matcher.PType, a.matcher.V0, a.matcher.V1, a.matcher.V2, a.matcher.V3, a.matcher.V4, a.matcher.V5} {
+		lines = append(lines, "? "+valueType+" "+nullability)
+		args = append(args, bun.Name(column))
+	}
+	reasonType := "text NULL"
+	if a.dialectName() == dialect.MSSQL {
+		reasonType = "nvarchar(max) NULL"
+	}
+	metadataLines, metadataArgs := a.metadataColumns(valueType+" NULL", reasonType, a.timestampType())
+	lines = append(lines, metadataLines...)
+	args = append(args, metadataArgs...)
+	if !a.compat.withoutID && a.dialectName() != dialect.SQLite {
+		lines = append(lines, "PRIMARY KEY (?)")
+		args = append(args, bun.Name(a.matcher.ID))
+	}
+	if a.compat.uniqueRule {
+		lines = append(lines, "CONSTRAINT ? UNIQUE (?)")
+		args = append(args, bun.Name("idx_"+a.matcher.TableName), a.ruleColumnList())
+	}
+	query := "CREATE TABLE IF NOT EXISTS ? (\n  " + strings.Join(lines, ",\n  ") + "\n)"
+	args = append([]interface{}{a.policyTable()}, args...)
+	if a.dialectName() == dialect.MSSQL {
+		tableName, err := a.formatSQL("?", a.policyTable())
+		if err != nil {
+			return "", err
+		}
+		query = "IF OBJECT_ID(?, 'U') IS NULL\nCREATE TABLE ? (\n  " + strings.Join(lines, ",\n  ") + "\n)"
+		args = append([]interface{}{tableName}, args...)
+	}
+	return a.formatSQL(query, args...)
+}
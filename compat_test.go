@@ -0,0 +1,114 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/mysqldialect"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestGormCompatibility$' *.go -v
+func TestGormCompatibility(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(), WithGormCompatibility())
+	assert.Equal(t, "casbin_rule", adapter.matcher.TableName)
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "public"."casbin_rule" (
+  "id" int8 GENERATED BY DEFAULT AS IDENTITY NOT NULL,
+  "ptype" varchar(100) NULL,
+  "v0" varchar(100) NULL,
+  "v1" varchar(100) NULL,
+  "v2" varchar(100) NULL,
+  "v3" varchar(100) NULL,
+  "v4" varchar(100) NULL,
+  "v5" varchar(100) NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "idx_casbin_rule" UNIQUE ("ptype", "v0", "v1", "v2", "v3", "v4", "v5")
+)`, ddl)
+
+	// Explicit table name wins regardless of options order
+	adapter = newDialectAdapter(pgdialect.New(), WithGormCompatibility(), WithMatcherOptions(MatcherOptions{SchemaName: "dev"}))
+	assert.Equal(t, "casbin_rule", adapter.matcher.TableName)
+	adapter = newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{TableName: "rules"}), WithGormCompatibility())
+	assert.Equal(t, "rules", adapter.matcher.TableName)
+	adapter = newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{TableName: defaultMatcherOpts.TableName}), WithXormCompatibility())
+	assert.Equal(t, defaultMatcherOpts.TableName, adapter.matcher.TableName)
+
+	adapter = newDialectAdapter(mysqldialect.New(), WithGormCompatibility())
+	values := map[string]interface{}{"ptype": "p", "v0": "alice"}
+	assert.Equal(t,
+		"INSERT INTO `casbin_rule` (`ptype`, `v0`) SELECT 'p', 'alice' FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM `casbin_rule` WHERE `ptype` = 'p' AND `v0` = 'alice')",
+		formatAppender(t, adapter, adapter.newNotExistsInsert(adapter.DB, values)),
+	)
+
+	ctx := context.Background()
+	adapter = newSQLiteAdapter(t, WithGormCompatibility())
+	// Row written by gorm-adapter: empty values are stored as empty strings
+	_, err = adapter.ExecContext(ctx, "INSERT INTO casbin_rule (ptype, v0, v1, v2, v3, v4, v5) VALUES ('p', 'alice', '', 'read', '', '', '')")
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"bob", "data2", "write"}))
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"bob", "data2", "write"}))
+	rows, err := adapter.selectPolicies(ctx, adapter.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	// Inner empty values are kept, trailing ones are skipped
+	assert.Equal(t, []string{"alice", "", "read"}, adapter.ruleDefinition(rows[0]))
+	assert.Equal(t, []string{"bob", "data2", "write"}, adapter.ruleDefinition(rows[1]))
+
+	/* Listener builds rules same way as LoadPolicy() does */
+	enforcer := newTestEnforcer(t)
+	innerEmpty := CasbinPolicy{PType: "p", V0: "carol", V1: "", V2: "read", V3: "allow"}
+	insert := TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: innerEmpty}
+	assert.NoError(t, adapter.applyTriggerPayload(enforcer, insert, insert.String()))
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"carol", "", "read", "allow"}}, policies)
+	batch := coalescedBatch{ruleDefinition: adapter.ruleDefinition}
+	batch.push(TriggerDataPayload{EventType: EVENT_PAYLOAD_DELETE, Old: innerEmpty})
+	assert.NoError(t, batch.apply(enforcer, 0))
+	policies, err = enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 0)
+}
+
+// go test -run '^TestXormCompatibility$' *.go -v
+func TestXormCompatibility(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t, WithXormCompatibility(), WithMatcherOptions(MatcherOptions{TableName: "xorm_casbin_rule"}))
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.NotContains(t, ddl, `"id"`)
+	assert.Contains(t, ddl, `"v5" varchar(100) NOT NULL DEFAULT ''`)
+
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.AddPolicy("g", "g", []string{"alice", "admin"}))
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "data1", "read", "allow"}}, policies)
+	groupings, err := enforcer.GetGroupingPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "admin"}}, groupings)
+
+	assert.NoError(t, adapter.RemovePolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	rows, err := adapter.selectPolicies(ctx, adapter.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, []CasbinPolicy{{PType: "g", V0: "alice", V1: "admin"}}, rows)
+
+	/* Inner empty values are kept same as by xorm-adapter */
+	enforcer = newTestEnforcerWithAdapter(t, adapter)
+	_, err = enforcer.AddPolicy("bob", "", "read", "allow")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcer.SavePolicy())
+	enforcer = newTestEnforcerWithAdapter(t, adapter)
+	policies, err = enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "", "read", "allow"}}, policies)
+
+	report, err := adapter.IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+}
@@ -0,0 +1,170 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	defaultCopyOpts = CopyOptions{
+		BatchSize: 500,
+	}
+)
+
+// CopyOptions is for copying policies between tables. See CopyPolicies()
+type CopyOptions struct {
+	// Number of rows written per transaction when adapters use different databases
+	BatchSize int
+	// If nothing needed to be written. Summary contains numbers of rows which would be copied and skipped
+	DryRun bool
+}
+
+// CopySummary describes result of CopyPolicies()
+type CopySummary struct {
+	// If nothing has been written
+	DryRun bool
+	// If both adapters use the same database, so everything has been done in single transaction
+	SameDatabase bool
+	// Number of rows read from the source table
+	Read int
+	// Number of rows written to the target table (or which would be written in dry-run mode)
+	Copied int
+	// Number of rows which exist in the target table already or are duplicated in the source table
+	Skipped int
+	// Number of transactions used for writing. Zero in dry-run mode
+	Batches int
+}
+
+// CopyPolicies reads policies via MatcherOptions of one adapter and writes them via MatcherOptions of another one, e.g. from legacy table into "dev.potato_policies".
+// Policies which exist in the target table already are skipped. Only rules valid now are copied and validity windows are not kept (see MatcherOptions.ValidFrom). When both adapters use the same database everything is done in single transaction,
+// otherwise rows are written in batches (see CopyOptions.BatchSize) and already written batches are kept if error occurs
+func CopyPolicies(ctx context.Context, from, to *BunAdapter, opts CopyOptions) (CopySummary, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultCopyOpts.BatchSize
+	}
+	from, err := from.resolveTarget(ctx)
+	if err != nil {
+		return CopySummary{DryRun: opts.DryRun}, err
+	}
+	to, err = to.resolveTarget(ctx)
+	if err != nil {
+		return CopySummary{DryRun: opts.DryRun}, err
+	}
+	summary := CopySummary{
+		DryRun:       opts.DryRun,
+		SameDatabase: from.DB.DB == to.DB.DB,
+	}
+	if summary.SameDatabase {
+		err := to.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			// Transaction has session setting of the target tenant, so source rows are read with setting of their own tenant
+			err := from.setTenantSetting(ctx, tx)
+			if err != nil {
+				return err
+			}
+			source, err := from.readCopiedPolicies(ctx, tx)
+			if err != nil {
+				return err
+			}
+			err = to.setTenantSetting(ctx, tx)
+			if err != nil {
+				return err
+			}
+			target, err := to.selectPolicies(ctx, tx)
+			if err != nil {
+				return errors.Wrap(err, "Can't read target table")
+			}
+			pending := collectCopiedPolicies(source, target, &summary)
+			if opts.DryRun || len(pending) == 0 {
+				return nil
+			}
+			summary.Batches = 1
+			return to.insertCopiedPolicies(ctx, tx, pending)
+		})
+		if err != nil {
+			return CopySummary{DryRun: opts.DryRun, SameDatabase: true}, errors.Wrap(err, "Can't copy policies")
+		}
+		return summary, nil
+	}
+	var source, target []CasbinPolicy
+	err = from.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		var err error
+		source, err = from.readCopiedPolicies(ctx, db)
+		return err
+	})
+	if err != nil {
+		return summary, errors.Wrap(err, "Can't copy policies")
+	}
+	err = to.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		var err error
+		target, err = to.selectPolicies(ctx, db)
+		return errors.Wrap(err, "Can't read target table")
+	})
+	if err != nil {
+		return summary, errors.Wrap(err, "Can't copy policies")
+	}
+	pending := collectCopiedPolicies(source, target, &summary)
+	if opts.DryRun {
+		return summary, nil
+	}
+	for start := 0; start < len(pending); start += opts.BatchSize {
+		end := start + opts.BatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		err = to.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+			return to.insertCopiedPolicies(ctx, tx, pending[start:end])
+		})
+		if err != nil {
+			return summary, errors.Wrapf(err, "Can't copy batch of policies (%d-%d of %d). Previous batches have been written", start, end, len(pending))
+		}
+		summary.Batches++
+	}
+	return summary, nil
+}
+
+// readCopiedPolicies reads source policies which are valid now
+func (a *BunAdapter) readCopiedPolicies(ctx context.Context, db bun.IDB) ([]CasbinPolicy, error) {
+	source, err := a.selectPoliciesWhere(ctx, db, a.scopeValidity(time.Now().UTC()))
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't read source table")
+	}
+	return source, nil
+}
+
+// collectCopiedPolicies returns source policies which do not exist in the target table. Duplicates are counted as skipped
+func collectCopiedPolicies(source, target []CasbinPolicy, summary *CopySummary) []CasbinPolicy {
+	seen := make(map[string]struct{}, len(source)+len(target))
+	for _, policy := range target {
+		seen[policyKey(policy)] = struct{}{}
+	}
+	summary.Read = len(source)
+	pending := []CasbinPolicy{}
+	for _, policy := range source {
+		key := policyKey(policy)
+		if _, ok := seen[key]; ok {
+			summary.Skipped++
+			continue
+		}
+		seen[key] = struct{}{}
+		pending = append(pending, policy)
+	}
+	summary.Copied = len(pending)
+	return pending
+}
+
+func (a *BunAdapter) insertCopiedPolicies(ctx context.Context, tx bun.Tx, policies []CasbinPolicy) error {
+	inserted := make([]CasbinPolicy, 0, len(policies))
+	for _, policy := range policies {
+		ok, err := a.insertPolicyIgnoringDuplicates(ctx, tx, a.insertValues(ctx, policy))
+		if err != nil {
+			return errors.Wrapf(err, "Can't insert single policy. Policy: %+v", policy)
+		}
+		if ok {
+			inserted = append(inserted, policy)
+		}
+	}
+	return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, inserted)
+}
@@ -0,0 +1,108 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestCopyPolicies$' *.go -v
+func TestCopyPolicies(t *testing.T) {
+	ctx := context.Background()
+	legacy := newSQLiteAdapter(t, WithGormCompatibility(), WithMatcherOptions(MatcherOptions{TableName: "legacy_rule"}))
+	for _, rule := range [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"carol", "data3", "read"}} {
+		assert.NoError(t, legacy.AddPolicy("p", "p", rule))
+	}
+	// Row with NULLs instead of empty strings is not caught by unique constraint, but it is the same policy
+	_, err := legacy.ExecContext(ctx, "INSERT INTO legacy_rule (ptype, v0, v1, v2) VALUES ('p', 'alice', 'data1', 'read')")
+	assert.NoError(t, err)
+
+	// Other database
+	target := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "potato_policies", V1: "haha"}))
+	assert.NoError(t, target.AddPolicy("p", "p", []string{"bob", "data2", "write"}))
+
+	summary, err := CopyPolicies(ctx, legacy, target, CopyOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, CopySummary{DryRun: true, SameDatabase: false, Read: 4, Copied: 2, Skipped: 2}, summary)
+	rows, err := target.selectPolicies(ctx, target.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+
+	// Same database: single transaction
+	sameDB := NewBunAdapter(legacy.DB, WithMatcherOptions(MatcherOptions{TableName: "potato_policies", V1: "haha"}))
+	assert.NoError(t, sameDB.CreateTable(ctx))
+	assert.NoError(t, sameDB.AddPolicy("p", "p", []string{"bob", "data2", "write"}))
+	summary, err = CopyPolicies(ctx, legacy, sameDB, CopyOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, CopySummary{SameDatabase: true, Read: 4, Copied: 2, Skipped: 2, Batches: 1}, summary)
+	rows, err = sameDB.selectPolicies(ctx, sameDB.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	// Different databases: batches
+	summary, err = CopyPolicies(ctx, legacy, target, CopyOptions{BatchSize: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, CopySummary{Read: 4, Copied: 2, Skipped: 2, Batches: 2}, summary)
+	rows, err = target.selectPolicies(ctx, target.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	rows, err = legacy.selectPolicies(ctx, legacy.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+}
+
+// go test -run '^TestCopyPoliciesRLS$' *.go -v
+func TestCopyPoliciesRLS(t *testing.T) {
+	ctx := context.Background()
+	rows := func(query string) [][]driver.Value {
+		if strings.Contains(query, "current_setting") {
+			return [][]driver.Value{{""}}
+		}
+		return nil
+	}
+	tenantOpts := func(tableName, tenant string) []func(*BunAdapter) {
+		return []func(*BunAdapter){WithMatcherOptions(MatcherOptions{TableName: tableName, Tenant: "tenant_id"}), WithTenant(tenant), WithRLSSetting("")}
+	}
+	sourceSetting := "SELECT set_config('app.tenant_id', 'acme', true)"
+	targetSetting := "SELECT set_config('app.tenant_id', 'globex', true)"
+	sourceSelect := `FROM "public"."legacy_policies"`
+
+	/* Same database: setting is switched within transaction */
+	connector := &recordingConnector{rows: rows}
+	db := newRecordingAdapter(pgdialect.New(), connector).DB
+	from := NewBunAdapter(db, tenantOpts("legacy_policies", "acme")...)
+	to := NewBunAdapter(db, tenantOpts("potato_policies", "globex")...)
+	_, err := CopyPolicies(ctx, from, to, CopyOptions{DryRun: true})
+	assert.NoError(t, err)
+	statements := connector.Statements()
+	source := indexOfStatement(statements, sourceSelect)
+	if assert.GreaterOrEqual(t, source, 0) {
+		assert.Equal(t, sourceSetting, statements[source-1])
+		assert.Equal(t, targetSetting, statements[source+1])
+	}
+
+	/* Different databases: source is read with its own setting */
+	sourceConnector := &recordingConnector{rows: rows}
+	from = NewBunAdapter(newRecordingAdapter(pgdialect.New(), sourceConnector).DB, tenantOpts("legacy_policies", "acme")...)
+	_, err = CopyPolicies(ctx, from, to, CopyOptions{DryRun: true})
+	assert.NoError(t, err)
+	statements = sourceConnector.Statements()
+	source = indexOfStatement(statements, sourceSelect)
+	if assert.GreaterOrEqual(t, source, 0) {
+		assert.Equal(t, sourceSetting, statements[source-1])
+	}
+}
+
+// indexOfStatement returns index of the first statement containing the text or -1
+func indexOfStatement(statements []string, text string) int {
+	for i, statement := range statements {
+		if strings.Contains(statement, text) {
+			return i
+		}
+	}
+	return -1
+}
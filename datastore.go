@@ -1,6 +1,8 @@
 package casbinbunadapter
 
 import (
+	"time"
+
 	"github.com/uptrace/bun"
 )
 
@@ -31,6 +33,16 @@ type CasbinPolicy struct {
 	V3            string `bun:"v3,type:varchar(256),nullzero" json:"v3"`
 	V4            string `bun:"v4,type:varchar(256),nullzero" json:"v4"`
 	V5            string `bun:"v5,type:varchar(256),nullzero" json:"v5"`
+	// Tenant is filled only for trigger payloads when MatcherOptions.Tenant is set
+	Tenant string `bun:"-" json:"tenant,omitempty"`
+	// Timestamps are filled only for trigger payloads when MatcherOptions.CreatedAt and MatcherOptions.UpdatedAt are set. See ListPolicies() too
+	CreatedAt *time.Time `bun:"-" json:"created_at,omitempty"`
+	UpdatedAt *time.Time `bun:"-" json:"updated_at,omitempty"`
+	// Validity window is filled only for trigger payloads when MatcherOptions.ValidFrom and MatcherOptions.ValidTo are set
+	ValidFrom *time.Time `bun:"-" json:"valid_from,omitempty"`
+	ValidTo   *time.Time `bun:"-" json:"valid_to,omitempty"`
+	// DeletedAt is filled only for trigger payloads when MatcherOptions.DeletedAt is set
+	DeletedAt *time.Time `bun:"-" json:"deleted_at,omitempty"`
 }
 
 // MatcherOptions is for matching user defined columns to canonical Casbin columns
@@ -45,6 +57,20 @@ type MatcherOptions struct {
 	V3         string
 	V4         string
 	V5         string
+	// Optional column holding tenant. When set every query is scoped by value passed via WithTenant()
+	Tenant string
+	// Optional columns holding actor who inserted the row, actor who changed it last time and reason of the change. See WithChangeMetadata()
+	CreatedBy string
+	UpdatedBy string
+	Reason    string
+	// Optional columns holding time of insertion and time of the last change of the row
+	CreatedAt string
+	UpdatedAt string
+	// Optional columns holding validity window of the rule. NULL means unbounded. Only rules valid now are loaded, see AddPolicyWithExpiry()
+	ValidFrom string
+	ValidTo   string
+	// Optional column enabling soft delete: removed rows are marked by time of removal instead of deleting. See Restore()
+	DeletedAt string
 }
 
 // TriggerOptions is for defining trigger whicl will be executed after data update in database table
@@ -61,6 +87,8 @@ type TriggerOptions struct {
 	TriggerReplace bool
 	// Name for PostgreSQL channel for listening updates
 	ChannelName string
+	// Name of single-row table (located in FunctionSchemaName) holding sequence of changes. See WaitForVersion() and LastWrittenVersion()
+	VersionTableName string
 }
 
 func (cp CasbinPolicy) getRuleDefinition() []string {
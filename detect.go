@@ -0,0 +1,95 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrColumnDetection is returned when column mapping can't be detected: table or column is missing or several columns match the same field
+	ErrColumnDetection = errors.New("Can't detect column mapping")
+)
+
+// detectedColumn lists conventional names of the column for the field of MatcherOptions
+type detectedColumn struct {
+	field      string
+	candidates []string
+	target     func(*MatcherOptions) *string
+}
+
+var detectedColumns = []detectedColumn{
+	{"MatcherOptions.ID", []string{"id", "rule_id", "policy_id"}, func(m *MatcherOptions) *string { return &m.ID }},
+	{"MatcherOptions.PType", []string{"ptype", "p_type", "policy_type"}, func(m *MatcherOptions) *string { return &m.PType }},
+	{"MatcherOptions.V0", valueCandidates(0), func(m *MatcherOptions) *string { return &m.V0 }},
+	{"MatcherOptions.V1", valueCandidates(1), func(m *MatcherOptions) *string { return &m.V1 }},
+	{"MatcherOptions.V2", valueCandidates(2), func(m *MatcherOptions) *string { return &m.V2 }},
+	{"MatcherOptions.V3", valueCandidates(3), func(m *MatcherOptions) *string { return &m.V3 }},
+	{"MatcherOptions.V4", valueCandidates(4), func(m *MatcherOptions) *string { return &m.V4 }},
+	{"MatcherOptions.V5", valueCandidates(5), func(m *MatcherOptions) *string { return &m.V5 }},
+}
+
+func valueCandidates(i int) []string {
+	return []string{fmt.Sprintf("v%d", i), fmt.Sprintf("v_%d", i), fmt.Sprintf("value%d", i), fmt.Sprintf("value_%d", i), fmt.Sprintf("val%d", i)}
+}
+
+// WithDetectedColumns makes adapter to build MatcherOptions by introspecting existing table (e.g. "casbin_rule" of gorm and xorm adapters).
+// Columns are matched case-insensitively with conventional names: "id", "rule_id", "policy_id" for ID, "ptype", "p_type", "policy_type" for PType
+// and "v0", "v_0", "value0", "value_0", "val0" for V0 (and so on). Empty names mean default schema and table. ID column is not required
+// along with WithXormCompatibility(). Detection requires database, so it is done by OpenBunAdapter() only: adapter returned by NewBunAdapter()
+// reports ErrColumnDetection from every method which accesses the policy table. Use DetectMatcherOptions() along with NewBunAdapter()
+func WithDetectedColumns(schemaName, tableName string) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		WithMatcherOptions(MatcherOptions{SchemaName: schemaName, TableName: tableName})(a)
+		a.detectColumns = true
+	}
+}
+
+// DetectMatcherOptions introspects existing table and returns MatcherOptions for it. See WithDetectedColumns() for naming conventions
+func DetectMatcherOptions(ctx context.Context, db *bun.DB, schemaName, tableName string) (MatcherOptions, error) {
+	a := NewBunAdapter(db, WithMatcherOptions(MatcherOptions{SchemaName: schemaName, TableName: tableName}))
+	err := a.detectMatcher(ctx)
+	if err != nil {
+		return MatcherOptions{}, err
+	}
+	return a.matcher, nil
+}
+
+// detectMatcher replaces column names of MatcherOptions with detected ones
+func (a *BunAdapter) detectMatcher(ctx context.Context) error {
+	columns, err := a.readTableColumns(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "Can't read columns of table '%s'", a.matcher.TableName)
+	}
+	if len(columns) == 0 {
+		return errors.Wrapf(ErrColumnDetection, "table '%s' does not exist", a.matcher.TableName)
+	}
+	matcher := a.matcher
+	for _, detected := range detectedColumns {
+		if detected.field == "MatcherOptions.ID" && a.compat.withoutID {
+			continue
+		}
+		found := []string{}
+		for _, column := range columns {
+			for _, candidate := range detected.candidates {
+				if strings.EqualFold(column.Name, candidate) {
+					found = append(found, column.Name)
+					break
+				}
+			}
+		}
+		switch len(found) {
+		case 0:
+			return errors.Wrapf(ErrColumnDetection, "table '%s' has no column for %s (expected one of: %s)", a.matcher.TableName, detected.field, strings.Join(detected.candidates, ", "))
+		case 1:
+			*detected.target(&matcher) = found[0]
+		default:
+			return errors.Wrapf(ErrColumnDetection, "table '%s' has several columns for %s: %s", a.matcher.TableName, detected.field, strings.Join(found, ", "))
+		}
+	}
+	a.matcher = matcher
+	return nil
+}
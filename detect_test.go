@@ -0,0 +1,57 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestDetectColumns$' *.go -v
+func TestDetectColumns(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	// Layout of gorm adapter
+	_, err := db.ExecContext(ctx, "CREATE TABLE casbin_rule (id INTEGER PRIMARY KEY AUTOINCREMENT, ptype varchar(100), v0 varchar(100), v1 varchar(100), v2 varchar(100), v3 varchar(100), v4 varchar(100), v5 varchar(100))")
+	assert.NoError(t, err)
+	adapter, err := OpenBunAdapter(db, WithDetectedColumns("", "casbin_rule"))
+	assert.NoError(t, err)
+	assert.Equal(t, "casbin_rule", adapter.matcher.TableName)
+	assert.Equal(t, "ptype", adapter.matcher.PType)
+	assert.Equal(t, "v5", adapter.matcher.V5)
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE custom_rules (Rule_ID INTEGER PRIMARY KEY, Policy_Type text, Value_0 text, Value_1 text, Value_2 text, Value_3 text, Value_4 text, Value_5 text)")
+	assert.NoError(t, err)
+	matcher, err := DetectMatcherOptions(ctx, db, "", "custom_rules")
+	assert.NoError(t, err)
+	assert.Equal(t, MatcherOptions{
+		SchemaName: defaultMatcherOpts.SchemaName, TableName: "custom_rules", ID: "Rule_ID", PType: "Policy_Type",
+		V0: "Value_0", V1: "Value_1", V2: "Value_2", V3: "Value_3", V4: "Value_4", V5: "Value_5",
+	}, matcher)
+
+	_, err = db.ExecContext(ctx, "CREATE TABLE ambiguous_rules (id INTEGER PRIMARY KEY, ptype text, v0 text, value0 text, v1 text, v2 text, v3 text, v4 text, v5 text)")
+	assert.NoError(t, err)
+	_, err = OpenBunAdapter(db, WithDetectedColumns("", "ambiguous_rules"))
+	assert.ErrorIs(t, err, ErrColumnDetection)
+	assert.Contains(t, err.Error(), "several columns for MatcherOptions.V0: v0, value0")
+
+	_, err = OpenBunAdapter(db, WithDetectedColumns("", "missing_rules"))
+	assert.ErrorIs(t, err, ErrColumnDetection)
+
+	/* Layout of xorm adapter has no ID column */
+	_, err = db.ExecContext(ctx, "CREATE TABLE xorm_rules (ptype varchar(100) NOT NULL DEFAULT '', v0 varchar(100) NOT NULL DEFAULT '', v1 varchar(100) NOT NULL DEFAULT '', v2 varchar(100) NOT NULL DEFAULT '', v3 varchar(100) NOT NULL DEFAULT '', v4 varchar(100) NOT NULL DEFAULT '', v5 varchar(100) NOT NULL DEFAULT '')")
+	assert.NoError(t, err)
+	_, err = OpenBunAdapter(db, WithDetectedColumns("", "xorm_rules"))
+	assert.ErrorIs(t, err, ErrColumnDetection)
+	adapter, err = OpenBunAdapter(db, WithXormCompatibility(), WithDetectedColumns("", "xorm_rules"))
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "data1", "read", "allow"}}, policies)
+
+	/* NewBunAdapter can not detect columns */
+	err = NewBunAdapter(db, WithDetectedColumns("", "casbin_rule")).AddPolicy("p", "p", []string{"alice", "data1", "read"})
+	assert.ErrorIs(t, err, ErrColumnDetection)
+}
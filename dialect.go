@@ -0,0 +1,407 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/schema"
+)
+
+const (
+	// ruleHashColumn is generated column used for uniqueness of rules in MySQL and Microsoft SQL Server
+	ruleHashColumn = "rule_hash"
+	// mssqlDefaultSchema is used instead of default "public" schema for Microsoft SQL Server
+	mssqlDefaultSchema = "dbo"
+	// mssqlErrUniqueConstraint and mssqlErrUniqueIndex are Microsoft SQL Server error numbers of duplicate key in unique constraint and unique index
+	mssqlErrUniqueConstraint = 2627
+	mssqlErrUniqueIndex      = 2601
+)
+
+var (
+	// ErrUnsupportedDialect is returned when operation is not available for the database dialect (e.g. triggers for SQLite)
+	ErrUnsupportedDialect = errors.New("Operation is not supported for database dialect")
+)
+
+// qualifiedName is schema-qualified name of table or function. Schema is omitted when it is empty
+type qualifiedName struct {
+	schema string
+	name   string
+}
+
+// AppendQuery implements schema.QueryAppender. Names are quoted the same way as columns (see fmter.IdentQuote()),
+// but unlike fmter.AppendName() dots within names are kept as is
+func (n qualifiedName) AppendQuery(fmter schema.Formatter, b []byte) ([]byte, error) {
+	quote := fmter.IdentQuote()
+	if n.schema != "" {
+		b = appendQuotedName(b, n.schema, quote)
+		b = append(b, '.')
+	}
+	return appendQuotedName(b, n.name, quote), nil
+}
+
+// appendQuotedName quotes identifier. Quote character within the name is escaped by doubling
+func appendQuotedName(b []byte, name string, quote byte) []byte {
+	b = append(b, quote)
+	for i := 0; i < len(name); i++ {
+		if name[i] == quote {
+			b = append(b, quote)
+		}
+		b = append(b, name[i])
+	}
+	return append(b, quote)
+}
+
+func (a *BunAdapter) dialectName() dialect.Name {
+	return a.Dialect().Name()
+}
+
+// tableSchema returns schema used for qualifying table names. SQLite does not support schemas (except attached databases), so it is empty there.
+// For MySQL schema is the database name: default "public" schema means current database of the connection.
+// For Microsoft SQL Server default "public" schema is replaced with "dbo"
+func (a *BunAdapter) tableSchema() string {
+	switch a.dialectName() {
+	case dialect.SQLite:
+		return ""
+	case dialect.MySQL:
+		if a.matcher.SchemaName == defaultMatcherOpts.SchemaName {
+			return ""
+		}
+		return a.matcher.SchemaName
+	case dialect.MSSQL:
+		if a.matcher.SchemaName == defaultMatcherOpts.SchemaName {
+			return mssqlDefaultSchema
+		}
+		return a.matcher.SchemaName
+	default:
+		return a.matcher.SchemaName
+	}
+}
+
+// policyTable returns qualified name of the policy table
+func (a *BunAdapter) policyTable() qualifiedName {
+	return a.qualifiedTable(a.matcher.TableName)
+}
+
+// qualifiedTable returns name of the table qualified with the schema of the policy table
+func (a *BunAdapter) qualifiedTable(name string) qualifiedName {
+	return qualifiedName{schema: a.tableSchema(), name: name}
+}
+
+// requireDialect returns ErrUnsupportedDialect if current dialect is not in the list
+func (a *BunAdapter) requireDialect(operation string, supported ...dialect.Name) error {
+	current := a.dialectName()
+	for _, name := range supported {
+		if current == name {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrUnsupportedDialect, "%s is not available for '%s'", operation, current)
+}
+
+// isMSSQLUniqueViolation checks error of Microsoft SQL Server driver (github.com/microsoft/go-mssqldb) for duplicate key without importing the driver
+func isMSSQLUniqueViolation(err error) bool {
+	var mssqlErr interface{ SQLErrorNumber() int32 }
+	if !errors.As(err, &mssqlErr) {
+		return false
+	}
+	number := mssqlErr.SQLErrorNumber()
+	return number == mssqlErrUniqueConstraint || number == mssqlErrUniqueIndex
+}
+
+// formatSQL formats query with bun placeholders for current dialect
+func (a *BunAdapter) formatSQL(query string, args ...interface{}) (string, error) {
+	b, err := a.NewRaw(query, args...).AppendQuery(a.Formatter(), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// clearPolicies removes all rows of the policy table (rows of current tenant only if MatcherOptions.Tenant is set) within the transaction.
+// TRUNCATE is used for PostgreSQL only, since other databases either do not have it or commit transaction implicitly
+func (a *BunAdapter) clearPolicies(ctx context.Context, tx bun.Tx) error {
+	var err error
+	switch {
+	case a.matcher.Tenant != "":
+		_, err = tx.NewDelete().
+			ModelTableExpr("?", a.policyTable()).
+			Where("? = ?", bun.Name(a.matcher.Tenant), a.tenant).
+			Exec(ctx)
+	case a.dialectName() == dialect.PG:
+		_, err = tx.NewTruncateTable().
+			ModelTableExpr("?", a.policyTable()).
+			Model((*CasbinPolicy)(nil)).
+			Exec(ctx)
+	default:
+		_, err = tx.NewDelete().
+			ModelTableExpr("?", a.policyTable()).
+			Where("1 = 1").
+			Exec(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	// TRUNCATE does not report number of rows, so clearing is always seen as change
+	markChanged(ctx, 1)
+	return nil
+}
+
+// insertPolicyIgnoringDuplicates inserts policy unless the same one exists already. It returns false when policy has been skipped.
+// Soft-deleted copy of the policy and copy which is not valid now (see MatcherOptions.ValidFrom) are removed first
+func (a *BunAdapter) insertPolicyIgnoringDuplicates(ctx context.Context, tx bun.Tx, values map[string]interface{}) (bool, error) {
+	err := a.purgeDeleted(ctx, tx, values)
+	if err != nil {
+		return false, err
+	}
+	err = a.purgeInvalid(ctx, tx, values)
+	if err != nil {
+		return false, err
+	}
+	var res sql.Result
+	switch {
+	case a.dialectName() == dialect.MSSQL:
+		res, err = a.newMSSQLIgnoringInsert(tx, values).Exec(ctx)
+	case a.compat.enabled():
+		// Table of other adapter could have no unique constraint
+		res, err = a.newNotExistsInsert(tx, values).Exec(ctx)
+	default:
+		res, err = a.newIgnoringInsert(tx, values).Exec(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	markChanged(ctx, affected)
+	return affected > 0, nil
+}
+
+// newMSSQLIgnoringInsert prepares "IF NOT EXISTS ... INSERT" statement. Range locks prevent concurrent insertion of the same rule
+func (a *BunAdapter) newMSSQLIgnoringInsert(db bun.IDB, values map[string]interface{}) *bun.RawQuery {
+	columns := a.ruleColumns()
+	conditions := make([]string, 0, len(columns))
+	conditionArgs := []interface{}{}
+	insertColumns := make([]string, 0, len(columns))
+	insertColumnArgs := []interface{}{}
+	insertValues := make([]string, 0, len(columns))
+	insertValueArgs := []interface{}{}
+	for _, column := range columns {
+		value, ok := values[column]
+		if !ok {
+			continue
+		}
+		conditions = append(conditions, "? = ?")
+		conditionArgs = append(conditionArgs, bun.Name(column), value)
+	}
+	for _, column := range a.insertedColumns(values) {
+		insertColumns = append(insertColumns, "?")
+		insertColumnArgs = append(insertColumnArgs, bun.Name(column))
+		insertValues = append(insertValues, "?")
+		insertValueArgs = append(insertValueArgs, values[column])
+	}
+	query := fmt.Sprintf(
+		"IF NOT EXISTS (SELECT 1 FROM ? WITH (UPDLOCK, HOLDLOCK) WHERE %s) INSERT INTO ? (%s) VALUES (%s)",
+		strings.Join(conditions, " AND "), strings.Join(insertColumns, ", "), strings.Join(insertValues, ", "),
+	)
+	args := []interface{}{a.policyTable()}
+	args = append(args, conditionArgs...)
+	args = append(args, a.policyTable())
+	args = append(args, insertColumnArgs...)
+	args = append(args, insertValueArgs...)
+	return db.NewRaw(query, args...)
+}
+
+// insertedColumns returns columns of the values: rule columns (see ruleColumns()) followed by other ones in alphabetical order
+func (a *BunAdapter) insertedColumns(values map[string]interface{}) []string {
+	columns := make([]string, 0, len(values))
+	known := make(map[string]struct{}, len(values))
+	for _, column := range a.ruleColumns() {
+		if _, ok := values[column]; ok {
+			columns = append(columns, column)
+			known[column] = struct{}{}
+		}
+	}
+	extra := []string{}
+	for column := range values {
+		if _, ok := known[column]; !ok {
+			extra = append(extra, column)
+		}
+	}
+	sort.Strings(extra)
+	return append(columns, extra...)
+}
+
+// newIgnoringInsert prepares INSERT query which does nothing on unique constraint violation
+func (a *BunAdapter) newIgnoringInsert(db bun.IDB, values map[string]interface{}) *bun.InsertQuery {
+	query := db.NewInsert().
+		ModelTableExpr("?", a.policyTable()).
+		Model(&values)
+	switch a.dialectName() {
+	case dialect.PG:
+		return query.On("CONFLICT (?) DO NOTHING", a.ruleColumnList())
+	default:
+		// ON CONFLICT DO NOTHING (without conflict target) for SQLite and INSERT IGNORE for MySQL
+		return query.Ignore()
+	}
+}
+
+// CreateTable creates policy table (if it does not exist) using DDL appropriate for current dialect and MatcherOptions
+func (a *BunAdapter) CreateTable(ctx context.Context) error {
+	ddl, err := a.CreateTableSQL()
+	if err != nil {
+		return err
+	}
+	_, err = a.ExecContext(ctx, ddl)
+	if err != nil {
+		return errors.Wrap(err, "Can't create policy table")
+	}
+	return nil
+}
+
+// DropTableSQL returns statement dropping the policy table (if it exists)
+func (a *BunAdapter) DropTableSQL() (string, error) {
+	return a.formatSQL("DROP TABLE IF EXISTS ?", a.policyTable())
+}
+
+// CreateTableSQL returns DDL of the policy table which is executed by CreateTable(). Nothing is executed, so DDL could be applied by migration tool
+func (a *BunAdapter) CreateTableSQL() (string, error) {
+	err := a.checkOptions()
+	if err != nil {
+		return "", err
+	}
+	if a.compat.enabled() {
+		return a.compatTableSQL()
+	}
+	var idType, ptypeType, valueType, tenantType string
+	switch a.dialectName() {
+	case dialect.PG:
+		idType, ptypeType, valueType, tenantType = "int4 GENERATED BY DEFAULT AS IDENTITY NOT NULL", "varchar(2) DEFAULT 'p' NOT NULL", "varchar(256) NULL", "varchar(256) NOT NULL"
+	case dialect.SQLite:
+		idType, ptypeType, valueType, tenantType = "INTEGER PRIMARY KEY AUTOINCREMENT", "varchar(2) DEFAULT 'p' NOT NULL", "varchar(256) NULL", "varchar(256) NOT NULL"
+	case dialect.MySQL:
+		idType, ptypeType, valueType, tenantType = "int NOT NULL AUTO_INCREMENT", "varchar(2) NOT NULL DEFAULT 'p'", "varchar(256) NULL", "varchar(256) NOT NULL"
+	case dialect.MSSQL:
+		idType, ptypeType, valueType, tenantType = "int IDENTITY(1,1) NOT NULL", "nvarchar(2) NOT NULL DEFAULT 'p'", "nvarchar(256) NULL", "nvarchar(256) NOT NULL"
+	default:
+		return "", a.requireDialect("Table creation", dialect.PG, dialect.SQLite, dialect.MySQL, dialect.MSSQL)
+	}
+	valueColumns := []string{a.matcher.V0, a.matcher.V1, a.matcher.V2, a.matcher.V3, a.matcher.V4, a.matcher.V5}
+	lines := []string{"? " + idType}
+	args := []interface{}{bun.Name(a.matcher.ID)}
+	if a.matcher.Tenant != "" {
+		lines = append(lines, "? "+tenantType)
+		args = append(args, bun.Name(a.matcher.Tenant))
+	}
+	lines = append(lines, "? "+ptypeType)
+	args = append(args, bun.Name(a.matcher.PType))
+	for _, column := range valueColumns {
+		lines = append(lines, "? "+valueType)
+		args = append(args, bun.Name(column))
+	}
+	reasonType := "text NULL"
+	if a.dialectName() == dialect.MSSQL {
+		reasonType = "nvarchar(max) NULL"
+	}
+	metadataLines, metadataArgs := a.metadataColumns(valueType, reasonType, a.timestampType())
+	lines = append(lines, metadataLines...)
+	args = append(args, metadataArgs...)
+	uniqueName := bun.Name(a.matcher.TableName + "_unique")
+	prefix := "CREATE TABLE IF NOT EXISTS ? (\n  "
+	suffix := "\n)"
+	prefixArgs := []interface{}{a.policyTable()}
+	switch a.dialectName() {
+	case dialect.PG:
+		lines = append(lines, "CONSTRAINT ? PRIMARY KEY (?)", "CONSTRAINT ? UNIQUE (?)")
+		args = append(args, bun.Name(a.matcher.TableName+"_pk"), bun.Name(a.matcher.ID), uniqueName, a.ruleColumnList())
+	case dialect.SQLite:
+		lines = append(lines, "CONSTRAINT ? UNIQUE (?)")
+		args = append(args, uniqueName, a.ruleColumnList())
+	case dialect.MySQL:
+		// Unique index over seven varchar(256) columns exceeds InnoDB key length limit (3072 bytes for utf8mb4),
+		// so uniqueness is guaranteed by stored hash of the whole rule
+		parts, partArgs := a.ruleHashParts("IFNULL")
+		lines = append(lines,
+			"? char(64) AS (SHA2(CONCAT_WS(CHAR(0), "+strings.Join(parts, ", ")+"), 256)) STORED",
+			"PRIMARY KEY (?)",
+			"UNIQUE KEY ? (?)",
+		)
+		args = append(args, bun.Name(ruleHashColumn))
+		args = append(args, partArgs...)
+		args = append(args, bun.Name(a.matcher.ID), uniqueName, bun.Name(ruleHashColumn))
+		suffix += " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+	case dialect.MSSQL:
+		// Nonclustered index key is limited by 1700 bytes, so uniqueness is guaranteed by persisted hash of the whole rule
+		tableName, err := a.formatSQL("?", a.policyTable())
+		if err != nil {
+			return "", err
+		}
+		parts, partArgs := a.ruleHashParts("ISNULL")
+		lines = append(lines,
+			"? AS CAST(HASHBYTES('SHA2_256', CONCAT("+strings.Join(parts, ", NCHAR(0), ")+")) AS binary(32)) PERSISTED",
+			"CONSTRAINT ? PRIMARY KEY (?)",
+			"CONSTRAINT ? UNIQUE (?)",
+		)
+		args = append(args, bun.Name(ruleHashColumn))
+		args = append(args, partArgs...)
+		args = append(args, bun.Name(a.matcher.TableName+"_pk"), bun.Name(a.matcher.ID), uniqueName, bun.Name(ruleHashColumn))
+		prefix = "IF OBJECT_ID(?, 'U') IS NULL\nCREATE TABLE ? (\n  "
+		prefixArgs = []interface{}{tableName, a.policyTable()}
+	}
+	return a.formatSQL(prefix+strings.Join(lines, ",\n  ")+suffix, append(prefixArgs, args...)...)
+}
+
+// timestampType returns DDL of nullable timestamp column for current dialect
+func (a *BunAdapter) timestampType() string {
+	switch a.dialectName() {
+	case dialect.PG:
+		return "timestamptz NULL"
+	case dialect.MySQL:
+		return "datetime(6) NULL"
+	case dialect.MSSQL:
+		return "datetime2 NULL"
+	default:
+		return "timestamp NULL"
+	}
+}
+
+// ruleHashParts returns expressions of rule columns for hashing. Nullable value columns are replaced with empty strings via nullFunc
+func (a *BunAdapter) ruleHashParts(nullFunc string) ([]string, []interface{}) {
+	parts := []string{}
+	args := []interface{}{}
+	for i, column := range a.ruleColumns() {
+		if i < len(a.ruleColumns())-6 {
+			// Tenant and ptype are NOT NULL
+			parts = append(parts, "?")
+		} else {
+			parts = append(parts, nullFunc+"(?, '')")
+		}
+		args = append(args, bun.Name(column))
+	}
+	return parts, args
+}
+
+// ruleColumns returns columns identifying the rule: tenant column (if any), ptype and value columns
+func (a *BunAdapter) ruleColumns() []string {
+	columns := []string{}
+	if a.matcher.Tenant != "" {
+		columns = append(columns, a.matcher.Tenant)
+	}
+	return append(columns, a.matcher.PType, a.matcher.V0, a.matcher.V1, a.matcher.V2, a.matcher.V3, a.matcher.V4, a.matcher.V5)
+}
+
+// ruleColumnList returns comma-separated list of ruleColumns()
+func (a *BunAdapter) ruleColumnList() schema.QueryAppender {
+	names := []bun.Ident{}
+	for _, column := range a.ruleColumns() {
+		names = append(names, bun.Ident(column))
+	}
+	return bun.In(names)
+}
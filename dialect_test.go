@@ -0,0 +1,235 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/dialect/mysqldialect"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/schema"
+)
+
+// offlineConnector refuses every connection. It lets dialects to be initialized without database
+type offlineConnector struct{}
+
+func (offlineConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("Offline connector")
+}
+
+func (c offlineConnector) Driver() driver.Driver {
+	return offlineDriver{}
+}
+
+type offlineDriver struct{}
+
+func (offlineDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("Offline driver")
+}
+
+// recordingConnector accepts every connection and records executed statements. Every query returns rows given by rows function
+// (no rows if it is nil). Row is list of column values. Statement fails with error returned by fail function if any
+type recordingConnector struct {
+	mu         sync.Mutex
+	statements []string
+	rows       func(query string) [][]driver.Value
+	fail       func(query string) error
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{connector: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return offlineDriver{}
+}
+
+func (c *recordingConnector) record(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, query)
+}
+
+// Statements returns recorded statements
+func (c *recordingConnector) Statements() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.statements...)
+}
+
+type recordingConn struct {
+	connector *recordingConnector
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("Prepared statements are not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.connector.record("BEGIN")
+	return c, nil
+}
+
+func (c *recordingConn) Commit() error {
+	c.connector.record("COMMIT")
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.connector.record("ROLLBACK")
+	return nil
+}
+
+func (c *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.connector.record(query)
+	if c.connector.fail != nil {
+		if err := c.connector.fail(query); err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.connector.record(query)
+	if c.connector.fail != nil {
+		if err := c.connector.fail(query); err != nil {
+			return nil, err
+		}
+	}
+	var rows [][]driver.Value
+	if c.connector.rows != nil {
+		rows = c.connector.rows(query)
+	}
+	return &recordingRows{rows: rows}, nil
+}
+
+type recordingRows struct {
+	rows [][]driver.Value
+}
+
+func (r *recordingRows) Columns() []string {
+	columns := []string{"value"}
+	if len(r.rows) > 0 {
+		columns = make([]string, len(r.rows[0]))
+		for i := range columns {
+			columns[i] = fmt.Sprintf("value%d", i)
+		}
+	}
+	return columns
+}
+
+func (r *recordingRows) Close() error {
+	return nil
+}
+
+func (r *recordingRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// newRecordingAdapter returns adapter of the dialect whose statements are recorded by connector instead of being executed
+func newRecordingAdapter(d schema.Dialect, connector *recordingConnector, opts ...func(*BunAdapter)) *BunAdapter {
+	return NewBunAdapter(bun.NewDB(sql.OpenDB(connector), d), opts...)
+}
+
+// newDialectAdapter returns adapter which is capable of building queries for the dialect only (there is no real connection)
+func newDialectAdapter(d schema.Dialect, opts ...func(*BunAdapter)) *BunAdapter {
+	return NewBunAdapter(bun.NewDB(sql.OpenDB(offlineConnector{}), d), opts...)
+}
+
+func formatAppender(t *testing.T, a *BunAdapter, appender schema.QueryAppender) string {
+	b, err := appender.AppendQuery(a.Formatter(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// go test -run '^TestMySQLDialect$' *.go -v
+func TestMySQLDialect(t *testing.T) {
+	adapter := newDialectAdapter(mysqldialect.New())
+	// Default schema means current database
+	assert.Equal(t, "`casbin_policy`", formatAppender(t, adapter, adapter.policyTable()))
+
+	adapter = newDialectAdapter(mysqldialect.New(), WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies"}))
+	assert.Equal(t, "`dev`.`potato_policies`", formatAppender(t, adapter, adapter.policyTable()))
+
+	values := map[string]interface{}{"ptype": "p", "v0": "alice"}
+	assert.Equal(t, "INSERT IGNORE INTO `dev`.`potato_policies` (`ptype`, `v0`) VALUES ('p', 'alice')", adapter.newIgnoringInsert(adapter.DB, values).String())
+
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, ddl, "CREATE TABLE IF NOT EXISTS `dev`.`potato_policies`")
+	assert.Contains(t, ddl, "`id` int NOT NULL AUTO_INCREMENT")
+	assert.Contains(t, ddl, "`rule_hash` char(64) AS (SHA2(CONCAT_WS(CHAR(0), `ptype`, IFNULL(`v0`, '')")
+	assert.Contains(t, ddl, "UNIQUE KEY `potato_policies_unique` (`rule_hash`)")
+
+	assert.ErrorIs(t, adapter.PrepareTrigger(), ErrUnsupportedDialect)
+}
+
+// mssqlTestDialect is PostgreSQL dialect reporting Microsoft SQL Server name, since mssqldialect is not a dependency of the module.
+// Only branching by dialect name is checked, formatting of names and values is the one of pgdialect
+type mssqlTestDialect struct {
+	*pgdialect.Dialect
+}
+
+func (mssqlTestDialect) Name() dialect.Name {
+	return dialect.MSSQL
+}
+
+// mssqlTestError mimics error of github.com/microsoft/go-mssqldb driver
+type mssqlTestError struct {
+	number int32
+}
+
+func (e mssqlTestError) Error() string {
+	return fmt.Sprintf("mssql: error %d", e.number)
+}
+
+func (e mssqlTestError) SQLErrorNumber() int32 {
+	return e.number
+}
+
+// go test -run '^TestMSSQLDialect$' *.go -v
+func TestMSSQLDialect(t *testing.T) {
+	adapter := newDialectAdapter(mssqlTestDialect{pgdialect.New()})
+	assert.Equal(t, `"dbo"."casbin_policy"`, formatAppender(t, adapter, adapter.policyTable()))
+
+	adapter = newDialectAdapter(mssqlTestDialect{pgdialect.New()}, WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: `potato"policies`}))
+	assert.Equal(t, `"dev"."potato""policies"`, formatAppender(t, adapter, adapter.policyTable()))
+
+	adapter = newDialectAdapter(mssqlTestDialect{pgdialect.New()}, WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies"}))
+	values := map[string]interface{}{"ptype": "p", "v0": "alice"}
+	assert.Equal(t,
+		`IF NOT EXISTS (SELECT 1 FROM "dev"."potato_policies" WITH (UPDLOCK, HOLDLOCK) WHERE "ptype" = 'p' AND "v0" = 'alice') INSERT INTO "dev"."potato_policies" ("ptype", "v0") VALUES ('p', 'alice')`,
+		formatAppender(t, adapter, adapter.newMSSQLIgnoringInsert(adapter.DB, values)),
+	)
+
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, ddl, "IF OBJECT_ID('\"dev\".\"potato_policies\"', 'U') IS NULL\nCREATE TABLE \"dev\".\"potato_policies\"")
+	assert.Contains(t, ddl, `"id" int IDENTITY(1,1) NOT NULL`)
+	assert.Contains(t, ddl, `"v0" nvarchar(256) NULL`)
+	assert.Contains(t, ddl, `"rule_hash" AS CAST(HASHBYTES('SHA2_256', CONCAT("ptype", NCHAR(0), ISNULL("v0", '')`)
+	assert.Contains(t, ddl, `CONSTRAINT "potato_policies_pk" PRIMARY KEY ("id")`)
+	assert.Contains(t, ddl, `CONSTRAINT "potato_policies_unique" UNIQUE ("rule_hash")`)
+
+	assert.ErrorIs(t, adapter.PrepareTrigger(), ErrUnsupportedDialect)
+}
@@ -0,0 +1,298 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultHistoryTable = "casbin_policy_history"
+)
+
+// PolicyOperation is kind of change recorded in the history table
+type PolicyOperation string
+
+var (
+	POLICY_OPERATION_INSERT = PolicyOperation("INSERT")
+	POLICY_OPERATION_DELETE = PolicyOperation("DELETE")
+	POLICY_OPERATION_UPDATE = PolicyOperation("UPDATE")
+)
+
+// ChangeMetadata describes who and why changes policies. It is recorded in the history table along with every change
+type ChangeMetadata struct {
+	Actor  string
+	Reason string
+}
+
+type changeMetadataKey struct{}
+
+// WithChangeMetadata returns context carrying metadata for changes made via *Ctx methods (see persist.ContextAdapter)
+func WithChangeMetadata(ctx context.Context, metadata ChangeMetadata) context.Context {
+	return context.WithValue(ctx, changeMetadataKey{}, metadata)
+}
+
+// ChangeMetadataFrom returns metadata stored by WithChangeMetadata(). Empty metadata is returned if there is no one
+func ChangeMetadataFrom(ctx context.Context) ChangeMetadata {
+	metadata, _ := ctx.Value(changeMetadataKey{}).(ChangeMetadata)
+	return metadata
+}
+
+// WithHistoryTable makes every write via adapter to record changed rules in the table located in MatcherOptions.SchemaName.
+// Empty name means default one: "casbin_policy_history". Table must be created via CreateHistoryTable()
+func WithHistoryTable(tableName string) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.historyTable = tableName
+		if a.historyTable == "" {
+			a.historyTable = defaultHistoryTable
+		}
+	}
+}
+
+// policyChangeRow is row of the history table. Old and new rules are stored as JSON arrays
+type policyChangeRow struct {
+	bun.BaseModel `bun:"casbin_policy_history,alias:h"`
+	ID            int64     `bun:"id,pk,autoincrement"`
+	Operation     string    `bun:"operation,type:varchar(16),notnull"`
+	Tenant        string    `bun:"tenant,type:varchar(256),nullzero"`
+	PType         string    `bun:"ptype,type:varchar(100),notnull"`
+	V0            string    `bun:"v0,type:varchar(256),nullzero"`
+	V1            string    `bun:"v1,type:varchar(256),nullzero"`
+	V2            string    `bun:"v2,type:varchar(256),nullzero"`
+	V3            string    `bun:"v3,type:varchar(256),nullzero"`
+	V4            string    `bun:"v4,type:varchar(256),nullzero"`
+	V5            string    `bun:"v5,type:varchar(256),nullzero"`
+	OldValues     string    `bun:"old_values,type:text,nullzero"`
+	NewValues     string    `bun:"new_values,type:text,nullzero"`
+	ChangedAt     time.Time `bun:"changed_at,notnull"`
+	Actor         string    `bun:"actor,type:varchar(256),nullzero"`
+	Reason        string    `bun:"reason,type:text,nullzero"`
+}
+
+// PolicyChange is single record of the history table
+type PolicyChange struct {
+	ID        int64
+	Operation PolicyOperation
+	// Tenant of the rule. Empty if MatcherOptions.Tenant is not set
+	Tenant string
+	PType  string
+	// Rule after the change (before the change for removal)
+	Rule []string
+	// Rule before the change. Nil for insertion
+	Old []string
+	// Rule after the change. Nil for removal
+	New       []string
+	ChangedAt time.Time
+	Actor     string
+	Reason    string
+}
+
+// HistoryFilter is for selecting records of the history table. Empty fields are not used
+type HistoryFilter struct {
+	// Matches v0: subject of "p" rules and user of "g" rules
+	Subject string
+	// Matches v1: object of "p" rules and role of "g" rules
+	Object string
+	PType  string
+	Actor  string
+	// Inclusive lower bound of change time
+	From time.Time
+	// Exclusive upper bound of change time
+	To time.Time
+	// Maximum number of records. Zero means no limit
+	Limit int
+}
+
+// CreateHistoryTable creates history table (see WithHistoryTable) if it does not exist
+func (a *BunAdapter) CreateHistoryTable(ctx context.Context) error {
+	if a.historyTable == "" {
+		return errors.New("History table is not enabled for the adapter. Use WithHistoryTable() option")
+	}
+	_, err := a.NewCreateTable().
+		Model((*policyChangeRow)(nil)).
+		ModelTableExpr("?", a.qualifiedTable(a.historyTable)).
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Can't create history table")
+	}
+	return nil
+}
+
+// QueryHistory returns records of the history table matching the filter in order of changes. Only records of current tenant are returned if MatcherOptions.Tenant is set.
+// History table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) QueryHistory(ctx context.Context, filter HistoryFilter) ([]PolicyChange, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if a.historyTable == "" {
+		return nil, errors.New("History table is not enabled for the adapter. Use WithHistoryTable() option")
+	}
+	var rows []policyChangeRow
+	err = a.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		query := db.NewSelect().
+			Model(&rows).
+			ModelTableExpr("? as h", a.qualifiedTable(a.historyTable)).
+			OrderExpr("? ASC", bun.Ident("id"))
+		if a.matcher.Tenant != "" {
+			query = query.Where("? = ?", bun.Ident("tenant"), a.tenant)
+		}
+		if filter.Subject != "" {
+			query = query.Where("? = ?", bun.Ident("v0"), filter.Subject)
+		}
+		if filter.Object != "" {
+			query = query.Where("? = ?", bun.Ident("v1"), filter.Object)
+		}
+		if filter.PType != "" {
+			query = query.Where("? = ?", bun.Ident("ptype"), filter.PType)
+		}
+		if filter.Actor != "" {
+			query = query.Where("? = ?", bun.Ident("actor"), filter.Actor)
+		}
+		if !filter.From.IsZero() {
+			query = query.Where("? >= ?", bun.Ident("changed_at"), filter.From.UTC())
+		}
+		if !filter.To.IsZero() {
+			query = query.Where("? < ?", bun.Ident("changed_at"), filter.To.UTC())
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+		return query.Scan(ctx)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't query policy history")
+	}
+	changes := make([]PolicyChange, 0, len(rows))
+	for _, row := range rows {
+		change, err := a.policyChange(row)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// policyChange converts history record into PolicyChange. Rule is built same way as LoadPolicy() does
+func (a *BunAdapter) policyChange(row policyChangeRow) (PolicyChange, error) {
+	change := PolicyChange{
+		ID:        row.ID,
+		Operation: PolicyOperation(row.Operation),
+		Tenant:    row.Tenant,
+		PType:     row.PType,
+		Rule:      a.ruleDefinition(CasbinPolicy{V0: row.V0, V1: row.V1, V2: row.V2, V3: row.V3, V4: row.V4, V5: row.V5}),
+		ChangedAt: row.ChangedAt,
+		Actor:     row.Actor,
+		Reason:    row.Reason,
+	}
+	for _, values := range []struct {
+		raw  string
+		rule *[]string
+	}{{row.OldValues, &change.Old}, {row.NewValues, &change.New}} {
+		if values.raw == "" {
+			continue
+		}
+		err := json.Unmarshal([]byte(values.raw), values.rule)
+		if err != nil {
+			return PolicyChange{}, errors.Wrapf(err, "Can't decode rule of history record %d", row.ID)
+		}
+	}
+	return change, nil
+}
+
+// recordHistory writes insertions or removals of the policies within the transaction. Metadata is taken from the context (see WithChangeMetadata())
+func (a *BunAdapter) recordHistory(ctx context.Context, tx bun.Tx, operation PolicyOperation, policies []CasbinPolicy) error {
+	entries := make([]historyEntry, 0, len(policies))
+	for i := range policies {
+		if operation == POLICY_OPERATION_DELETE {
+			entries = append(entries, historyEntry{old: &policies[i]})
+		} else {
+			entries = append(entries, historyEntry{new: &policies[i]})
+		}
+	}
+	return a.writeHistory(ctx, tx, operation, entries)
+}
+
+// historyEntry is single change of the rule. Old rule is nil for insertion and new one is nil for removal
+type historyEntry struct {
+	old *CasbinPolicy
+	new *CasbinPolicy
+}
+
+// writeHistory writes changes within the transaction. Rule columns of the record are taken from new rule if any
+func (a *BunAdapter) writeHistory(ctx context.Context, tx bun.Tx, operation PolicyOperation, entries []historyEntry) error {
+	if a.historyTable == "" || len(entries) == 0 {
+		return nil
+	}
+	metadata := a.changeMetadata(ctx)
+	changedAt := time.Now().UTC()
+	rows := make([]policyChangeRow, 0, len(entries))
+	for _, entry := range entries {
+		policy := entry.new
+		if policy == nil {
+			policy = entry.old
+		}
+		row := policyChangeRow{
+			Operation: string(operation),
+			Tenant:    a.tenant,
+			PType:     policy.PType,
+			V0:        policy.V0,
+			V1:        policy.V1,
+			V2:        policy.V2,
+			V3:        policy.V3,
+			V4:        policy.V4,
+			V5:        policy.V5,
+			ChangedAt: changedAt,
+			Actor:     metadata.Actor,
+			Reason:    metadata.Reason,
+		}
+		for _, values := range []struct {
+			policy *CasbinPolicy
+			raw    *string
+		}{{entry.old, &row.OldValues}, {entry.new, &row.NewValues}} {
+			if values.policy == nil {
+				continue
+			}
+			rule, err := json.Marshal(a.ruleDefinition(*values.policy))
+			if err != nil {
+				return errors.Wrap(err, "Can't encode rule for history")
+			}
+			*values.raw = string(rule)
+		}
+		rows = append(rows, row)
+	}
+	_, err := tx.NewInsert().
+		Model(&rows).
+		ModelTableExpr("?", a.qualifiedTable(a.historyTable)).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Can't record policy history")
+	}
+	return nil
+}
+
+// recordStateChange records difference between previous and current state of the table (e.g. for SavePolicy())
+func (a *BunAdapter) recordStateChange(ctx context.Context, tx bun.Tx, previous, current []CasbinPolicy) error {
+	if a.historyTable == "" {
+		return nil
+	}
+	removed, added := []CasbinPolicy{}, []CasbinPolicy{}
+	for _, change := range diffPolicyStates(policyState(previous), policyState(current)) {
+		switch change.EventType {
+		case EVENT_PAYLOAD_DELETE:
+			removed = append(removed, change.Old)
+		case EVENT_PAYLOAD_INSERT:
+			added = append(added, change.New)
+		}
+	}
+	err := a.recordHistory(ctx, tx, POLICY_OPERATION_DELETE, removed)
+	if err != nil {
+		return err
+	}
+	return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, added)
+}
@@ -0,0 +1,59 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestPolicyHistory$' *.go -v
+func TestPolicyHistory(t *testing.T) {
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "history_policies"}), WithHistoryTable("history_policies_log"))
+	ctx := context.Background()
+	assert.NoError(t, adapter.CreateHistoryTable(ctx))
+	started := time.Now().Add(-time.Second)
+
+	grantCtx := WithChangeMetadata(ctx, ChangeMetadata{Actor: "alice", Reason: "TICKET-1"})
+	assert.NoError(t, adapter.AddPolicyCtx(grantCtx, "g", "g", []string{"bob", "admin"}))
+	// Duplicates are not recorded
+	assert.NoError(t, adapter.AddPolicyCtx(grantCtx, "g", "g", []string{"bob", "admin"}))
+	assert.NoError(t, adapter.AddPolicyCtx(ctx, "p", "p", []string{"admin", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.RemoveFilteredPolicyCtx(WithChangeMetadata(ctx, ChangeMetadata{Actor: "carol"}), "g", "g", 0, "bob"))
+
+	changes, err := adapter.QueryHistory(ctx, HistoryFilter{Subject: "bob", Object: "admin"})
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, POLICY_OPERATION_INSERT, changes[0].Operation)
+		assert.Equal(t, "alice", changes[0].Actor)
+		assert.Equal(t, "TICKET-1", changes[0].Reason)
+		assert.Equal(t, []string{"bob", "admin"}, changes[0].New)
+		assert.Nil(t, changes[0].Old)
+		assert.Equal(t, POLICY_OPERATION_DELETE, changes[1].Operation)
+		assert.Equal(t, "carol", changes[1].Actor)
+		assert.Equal(t, []string{"bob", "admin"}, changes[1].Old)
+	}
+
+	changes, err = adapter.QueryHistory(ctx, HistoryFilter{PType: "p", From: started, To: time.Now().Add(time.Second)})
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	changes, err = adapter.QueryHistory(ctx, HistoryFilter{To: started})
+	assert.NoError(t, err)
+	assert.Len(t, changes, 0)
+
+	/* SavePolicy records difference only */
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	_, err = enforcer.AddPolicy("bob", "data2", "write", "allow")
+	assert.NoError(t, err)
+	enforcer.EnableAutoSave(false)
+	_, err = enforcer.RemovePolicy("admin", "data1", "read", "allow")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcer.SavePolicy())
+	changes, err = adapter.QueryHistory(ctx, HistoryFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 5) {
+		assert.Equal(t, POLICY_OPERATION_DELETE, changes[4].Operation)
+		assert.Equal(t, []string{"admin", "data1", "read", "allow"}, changes[4].Rule)
+	}
+}
@@ -0,0 +1,359 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+var (
+	// ErrHubClosed is returned by subscriptions which have been terminated due UpdatesHub.Close() call
+	ErrHubClosed = errors.New("Updates hub is closed")
+	// ErrUnsubscribed is returned by subscriptions which have been terminated due Subscription.Unsubscribe() call
+	ErrUnsubscribed = errors.New("Subscription has been cancelled")
+)
+
+// UpdatesHub owns single LISTEN connection per PostgreSQL channel and fans out change events to every subscriber.
+// Use it when several enforcers, caches or audit sinks in one process need database updates.
+type UpdatesHub struct {
+	db *bun.DB
+	// Opens LISTEN connection for the channel. Replaced in tests
+	listen   func(ctx context.Context, channel string) (hubListener, error)
+	mu       sync.Mutex
+	channels map[string]*hubChannel
+	// Channels being listened. Channel is closed when LISTEN is done, so lock is not held during network I/O
+	pending map[string]chan struct{}
+	nextID  int
+	closed  bool
+}
+
+// hubListener is LISTEN connection of single channel. It is satisfied by *pgdriver.Listener
+type hubListener interface {
+	Channel(opts ...pgdriver.ChannelOption) <-chan pgdriver.Notification
+	Close() error
+}
+
+type hubChannel struct {
+	listener    hubListener
+	subscribers map[int]*Subscription
+}
+
+// Subscription is single consumer of change events received by UpdatesHub
+type Subscription struct {
+	id      int
+	channel string
+	hub     *UpdatesHub
+	ptypes  map[string]struct{}
+	handler func(TriggerDataPayload) error
+	once    sync.Once
+	done    chan struct{}
+	err     error
+}
+
+// NewUpdatesHub returns new *UpdatesHub. LISTEN connections are opened on demand by the first subscriber of the channel
+func NewUpdatesHub(db *bun.DB) *UpdatesHub {
+	h := &UpdatesHub{
+		db:       db,
+		channels: make(map[string]*hubChannel),
+		pending:  make(map[string]chan struct{}),
+	}
+	h.listen = h.listenPG
+	return h
+}
+
+// listenPG opens LISTEN connection via pgdriver
+func (h *UpdatesHub) listenPG(ctx context.Context, channel string) (hubListener, error) {
+	ln := pgdriver.NewListener(h.db)
+	err := ln.Listen(ctx, channel)
+	if err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// WithPTypes limits subscription to events where old or new policy has one of given policy types (e.g. "p", "g2").
+// EVENT_PAYLOAD_RELOAD events are always delivered, since they concern every policy type
+func WithPTypes(ptypes ...string) func(*Subscription) {
+	return func(s *Subscription) {
+		if s.ptypes == nil {
+			s.ptypes = make(map[string]struct{}, len(ptypes))
+		}
+		for _, ptype := range ptypes {
+			s.ptypes[ptype] = struct{}{}
+		}
+	}
+}
+
+// Subscribe registers callback for change events of the given channel. Callbacks are called sequentially from the hub goroutine,
+// so slow callback delays other subscribers of the same channel. If callback returns an error then subscription is terminated with it.
+// Context limits opening of LISTEN connection only
+func (h *UpdatesHub) Subscribe(ctx context.Context, channel string, handler func(TriggerDataPayload) error, opts ...func(*Subscription)) (*Subscription, error) {
+	sub := newSubscription(h, channel, opts...)
+	sub.handler = handler
+	err := h.register(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// newSubscription prepares subscription which is not registered yet
+func newSubscription(h *UpdatesHub, channel string, opts ...func(*Subscription)) *Subscription {
+	sub := &Subscription{
+		channel: channel,
+		hub:     h,
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	return sub
+}
+
+// register attaches fully prepared subscription to the channel. LISTEN connection is opened for the first subscriber of the channel
+// without holding the lock; other subscribers of the same channel wait for it
+func (h *UpdatesHub) register(ctx context.Context, sub *Subscription) error {
+	for {
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			return ErrHubClosed
+		}
+		if hc, ok := h.channels[sub.channel]; ok {
+			h.attach(hc, sub)
+			h.mu.Unlock()
+			return nil
+		}
+		done, busy := h.pending[sub.channel]
+		if !busy {
+			h.pending[sub.channel] = make(chan struct{})
+			h.mu.Unlock()
+			break
+		}
+		h.mu.Unlock()
+		// Failed LISTEN is retried by one of waiting calls
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "Can't wait for database LISTEN for channel '%s'", sub.channel)
+		}
+	}
+	ln, err := h.listen(ctx, sub.channel)
+	h.mu.Lock()
+	close(h.pending[sub.channel])
+	delete(h.pending, sub.channel)
+	if err == nil && h.closed {
+		_ = ln.Close()
+		err = ErrHubClosed
+	}
+	if err != nil {
+		h.mu.Unlock()
+		if errors.Is(err, ErrHubClosed) {
+			return err
+		}
+		return errors.Wrapf(err, "Can't initialize database LISTEN for channel '%s'", sub.channel)
+	}
+	hc := &hubChannel{
+		listener:    ln,
+		subscribers: make(map[int]*Subscription),
+	}
+	h.channels[sub.channel] = hc
+	h.attach(hc, sub)
+	h.mu.Unlock()
+	go h.dispatch(sub.channel, hc)
+	return nil
+}
+
+// attach adds subscription to the channel. Lock must be held
+func (h *UpdatesHub) attach(hc *hubChannel, sub *Subscription) {
+	h.nextID++
+	sub.id = h.nextID
+	hc.subscribers[sub.id] = sub
+}
+
+// SubscribeChan registers Go channel for change events of the given channel. Sending blocks when channel buffer is full.
+// Channel is closed when subscription is terminated. Context limits opening of LISTEN connection only
+func (h *UpdatesHub) SubscribeChan(ctx context.Context, channel string, buffer int, opts ...func(*Subscription)) (*Subscription, <-chan TriggerDataPayload, error) {
+	events := make(chan TriggerDataPayload, buffer)
+	// Guards events channel against sending after it has been closed
+	var mu sync.Mutex
+	closed := false
+	// Subscription must be complete before registering, since handler could be called right after it
+	sub := newSubscription(h, channel, opts...)
+	sub.handler = func(payload TriggerDataPayload) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return nil
+		}
+		select {
+		case events <- payload:
+		case <-sub.done:
+		}
+		return nil
+	}
+	err := h.register(ctx, sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		<-sub.done
+		mu.Lock()
+		closed = true
+		close(events)
+		mu.Unlock()
+	}()
+	return sub, events, nil
+}
+
+// SubscribeEnforcer applies change events of the adapter channel to the enforcer. It is shared-connection analogue of StartUpdatesListening().
+// Context limits opening of LISTEN connection only
+func (a *BunAdapter) SubscribeEnforcer(ctx context.Context, hub *UpdatesHub, enforcer *casbin.SyncedEnforcer, opts ...func(*Subscription)) (*Subscription, error) {
+	return hub.Subscribe(ctx, a.trigger.ChannelName, func(payload TriggerDataPayload) error {
+		payload, ok := a.scopePayload(payload)
+		if !ok {
+			return nil
+		}
+		err := a.applyTriggerPayload(enforcer, payload, payload.String())
+		if err != nil {
+			return err
+		}
+		a.applied.advance(payload.Version)
+		return nil
+	}, opts...)
+}
+
+// Close terminates every subscription with ErrHubClosed and closes all LISTEN connections
+func (h *UpdatesHub) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	channels := h.channels
+	h.channels = make(map[string]*hubChannel)
+	subscribers := []*Subscription{}
+	for _, hc := range channels {
+		for _, sub := range hc.subscribers {
+			subscribers = append(subscribers, sub)
+		}
+		hc.subscribers = make(map[int]*Subscription)
+	}
+	h.mu.Unlock()
+	for _, sub := range subscribers {
+		sub.terminate(ErrHubClosed)
+	}
+	var firstErr error
+	for _, hc := range channels {
+		err := hc.listener.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h *UpdatesHub) dispatch(channel string, hc *hubChannel) {
+	for msg := range hc.listener.Channel() {
+		payload := TriggerDataPayload{}
+		err := json.Unmarshal([]byte(msg.Payload), &payload)
+		if err != nil {
+			h.terminateChannel(channel, hc, errors.Wrapf(err, "Can't read payload from database. Payload is: '%s'", msg.Payload))
+			return
+		}
+		h.mu.Lock()
+		subscribers := make([]*Subscription, 0, len(hc.subscribers))
+		for _, sub := range hc.subscribers {
+			subscribers = append(subscribers, sub)
+		}
+		h.mu.Unlock()
+		for _, sub := range subscribers {
+			if !sub.matches(payload) {
+				continue
+			}
+			select {
+			case <-sub.done:
+				continue
+			default:
+			}
+			err = sub.handler(payload)
+			if err != nil {
+				h.remove(sub, err)
+			}
+		}
+	}
+}
+
+// terminateChannel stops every subscriber of the channel and closes its LISTEN connection
+func (h *UpdatesHub) terminateChannel(channel string, hc *hubChannel, reason error) {
+	h.mu.Lock()
+	if h.channels[channel] == hc {
+		delete(h.channels, channel)
+	}
+	subscribers := hc.subscribers
+	hc.subscribers = make(map[int]*Subscription)
+	h.mu.Unlock()
+	for _, sub := range subscribers {
+		sub.terminate(reason)
+	}
+	_ = hc.listener.Close()
+}
+
+// remove detaches subscriber from the hub. LISTEN connection is closed when the last subscriber of the channel leaves
+func (h *UpdatesHub) remove(sub *Subscription, reason error) {
+	h.mu.Lock()
+	var obsolete *hubChannel
+	if hc, ok := h.channels[sub.channel]; ok {
+		delete(hc.subscribers, sub.id)
+		if len(hc.subscribers) == 0 {
+			delete(h.channels, sub.channel)
+			obsolete = hc
+		}
+	}
+	h.mu.Unlock()
+	sub.terminate(reason)
+	if obsolete != nil {
+		_ = obsolete.listener.Close()
+	}
+}
+
+func (s *Subscription) matches(payload TriggerDataPayload) bool {
+	if len(s.ptypes) == 0 || payload.EventType == EVENT_PAYLOAD_RELOAD {
+		return true
+	}
+	if _, ok := s.ptypes[payload.New.PType]; ok {
+		return true
+	}
+	_, ok := s.ptypes[payload.Old.PType]
+	return ok
+}
+
+func (s *Subscription) terminate(reason error) {
+	s.once.Do(func() {
+		s.err = reason
+		close(s.done)
+	})
+}
+
+// Unsubscribe detaches subscription from the hub
+func (s *Subscription) Unsubscribe() {
+	s.hub.remove(s, ErrUnsubscribed)
+}
+
+// Done returns channel which is closed when subscription is terminated
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason of subscription termination. It is nil while subscription is active
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
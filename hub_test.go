@@ -0,0 +1,259 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// fakeHubListener replaces LISTEN connection. Notifications are sent by notify()
+type fakeHubListener struct {
+	mu     sync.Mutex
+	ch     chan pgdriver.Notification
+	closed bool
+}
+
+func (l *fakeHubListener) Channel(opts ...pgdriver.ChannelOption) <-chan pgdriver.Notification {
+	return l.ch
+}
+
+func (l *fakeHubListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.ch)
+	}
+	return nil
+}
+
+func (l *fakeHubListener) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+func (l *fakeHubListener) notify(payload TriggerDataPayload) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.ch <- pgdriver.Notification{Payload: payload.String()}
+}
+
+// newTestHub returns hub with fake LISTEN connections. Listeners are stored by channel name
+func newTestHub() (*UpdatesHub, map[string]*fakeHubListener) {
+	listeners := map[string]*fakeHubListener{}
+	hub := NewUpdatesHub(nil)
+	hub.listen = func(ctx context.Context, channel string) (hubListener, error) {
+		ln := &fakeHubListener{ch: make(chan pgdriver.Notification, 16)}
+		listeners[channel] = ln
+		return ln, nil
+	}
+	return hub, listeners
+}
+
+func insertPayload(version int64, ptype string, rule ...string) TriggerDataPayload {
+	return TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, Version: version, New: NewCasbinPolicyFrom(ptype, rule)}
+}
+
+func receivePayload(t *testing.T, events <-chan TriggerDataPayload) TriggerDataPayload {
+	select {
+	case payload := <-events:
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("No event has been received")
+		return TriggerDataPayload{}
+	}
+}
+
+// go test -run '^TestUpdatesHubSubscribe$' *.go -v
+func TestUpdatesHubSubscribe(t *testing.T) {
+	hub, listeners := newTestHub()
+	defer hub.Close()
+	all := make(chan TriggerDataPayload, 4)
+	groupings := make(chan TriggerDataPayload, 4)
+	_, err := hub.Subscribe(context.Background(), "casbin", func(payload TriggerDataPayload) error {
+		all <- payload
+		return nil
+	})
+	assert.NoError(t, err)
+	failing, err := hub.Subscribe(context.Background(), "casbin", func(payload TriggerDataPayload) error {
+		groupings <- payload
+		return errors.New("sink is down")
+	}, WithPTypes("g"))
+	assert.NoError(t, err)
+	assert.Len(t, listeners, 1)
+
+	listeners["casbin"].notify(insertPayload(1, "p", "alice", "data1", "read", "allow"))
+	listeners["casbin"].notify(insertPayload(2, "g", "alice", "admin"))
+	assert.Equal(t, int64(1), receivePayload(t, all).Version)
+	assert.Equal(t, int64(2), receivePayload(t, all).Version)
+	assert.Equal(t, []string{"alice", "admin"}, receivePayload(t, groupings).New.getRuleDefinition())
+
+	/* Error of the callback terminates subscription */
+	select {
+	case <-failing.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Subscription has not been terminated")
+	}
+	assert.EqualError(t, failing.Err(), "sink is down")
+	listeners["casbin"].notify(insertPayload(3, "g", "bob", "admin"))
+	assert.Equal(t, int64(3), receivePayload(t, all).Version)
+	assert.Len(t, groupings, 0)
+
+	/* Reload is delivered regardless of policy types */
+	_, policies, err := hub.SubscribeChan(context.Background(), "casbin", 2, WithPTypes("p"))
+	assert.NoError(t, err)
+	listeners["casbin"].notify(insertPayload(4, "g", "carol", "admin"))
+	listeners["casbin"].notify(TriggerDataPayload{EventType: EVENT_PAYLOAD_RELOAD, Version: 5})
+	assert.Equal(t, EVENT_PAYLOAD_RELOAD, receivePayload(t, policies).EventType)
+}
+
+// go test -run '^TestUpdatesHubSubscribeChan$' *.go -v
+func TestUpdatesHubSubscribeChan(t *testing.T) {
+	hub, listeners := newTestHub()
+	defer hub.Close()
+	sub, events, err := hub.SubscribeChan(context.Background(), "casbin", 1)
+	assert.NoError(t, err)
+	assert.Nil(t, sub.Err())
+	listeners["casbin"].notify(insertPayload(1, "p", "alice", "data1", "read", "allow"))
+	assert.Equal(t, int64(1), receivePayload(t, events).Version)
+
+	/* Unsubscribe closes channel and LISTEN connection of the last subscriber */
+	sub.Unsubscribe()
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.ErrorIs(t, sub.Err(), ErrUnsubscribed)
+	assert.True(t, listeners["casbin"].isClosed())
+
+	/* Next subscriber opens new connection */
+	_, _, err = hub.SubscribeChan(context.Background(), "casbin", 1)
+	assert.NoError(t, err)
+	assert.False(t, listeners["casbin"].isClosed())
+}
+
+// go test -race -run '^TestUpdatesHubSubscribeChanRace$' *.go -v
+func TestUpdatesHubSubscribeChanRace(t *testing.T) {
+	hub, listeners := newTestHub()
+	defer hub.Close()
+	// Keeps LISTEN connection open while other subscribers come and go
+	_, err := hub.Subscribe(context.Background(), "casbin", func(TriggerDataPayload) error { return nil })
+	assert.NoError(t, err)
+	stop := make(chan struct{})
+	pumped := make(chan struct{})
+	go func() {
+		defer close(pumped)
+		for version := int64(1); ; version++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			listeners["casbin"].notify(insertPayload(version, "p", "alice", "data1", "read", "allow"))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		sub, events, err := hub.SubscribeChan(context.Background(), "casbin", 0)
+		assert.NoError(t, err)
+		receivePayload(t, events)
+		sub.Unsubscribe()
+	}
+	close(stop)
+	<-pumped
+}
+
+// go test -run '^TestUpdatesHubSlowListen$' *.go -v
+func TestUpdatesHubSlowListen(t *testing.T) {
+	started := make(chan struct{})
+	hub := NewUpdatesHub(nil)
+	defer hub.Close()
+	hub.listen = func(ctx context.Context, channel string) (hubListener, error) {
+		if channel == "fast" {
+			return &fakeHubListener{ch: make(chan pgdriver.Notification, 16)}, nil
+		}
+		close(started)
+		// LISTEN hangs until caller gives up
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	slowErr := make(chan error, 1)
+	go func() {
+		_, err := hub.Subscribe(ctx, "slow", func(TriggerDataPayload) error { return nil })
+		slowErr <- err
+	}()
+	<-started
+
+	/* Other channels are not blocked */
+	sub, _, err := hub.SubscribeChan(context.Background(), "fast", 1)
+	assert.NoError(t, err)
+	sub.Unsubscribe()
+
+	/* Subscriber of the same channel waits for LISTEN within its context */
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	_, err = hub.Subscribe(waitCtx, "slow", func(TriggerDataPayload) error { return nil })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	cancel()
+	select {
+	case err = <-slowErr:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe has not been cancelled")
+	}
+}
+
+// go test -run '^TestSubscribeEnforcer$' *.go -v
+func TestSubscribeEnforcer(t *testing.T) {
+	hub, listeners := newTestHub()
+	defer hub.Close()
+	adapter := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{Tenant: "tenant"}), WithTenant("acme"))
+	enforcer := newTestEnforcer(t)
+	sub, err := adapter.SubscribeEnforcer(context.Background(), hub, enforcer)
+	assert.NoError(t, err)
+
+	other := insertPayload(1, "p", "bob", "data1", "read", "allow")
+	other.New.Tenant = "other"
+	own := insertPayload(2, "p", "alice", "data1", "read", "allow")
+	own.New.Tenant = "acme"
+	listeners[adapter.trigger.ChannelName].notify(other)
+	listeners[adapter.trigger.ChannelName].notify(own)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, adapter.WaitForVersion(ctx, 2))
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "data1", "read", "allow"}}, policies)
+
+	/* Bad payload is reported to every subscriber of the channel */
+	listeners[adapter.trigger.ChannelName].ch <- pgdriver.Notification{Payload: "{"}
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Subscription has not been terminated")
+	}
+	assert.Error(t, sub.Err())
+}
+
+// go test -run '^TestUpdatesHubClose$' *.go -v
+func TestUpdatesHubClose(t *testing.T) {
+	hub, listeners := newTestHub()
+	sub, events, err := hub.SubscribeChan(context.Background(), "casbin", 1)
+	assert.NoError(t, err)
+	assert.NoError(t, hub.Close())
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.ErrorIs(t, sub.Err(), ErrHubClosed)
+	assert.True(t, listeners["casbin"].isClosed())
+	_, err = hub.Subscribe(context.Background(), "casbin", func(TriggerDataPayload) error { return nil })
+	assert.ErrorIs(t, err, ErrHubClosed)
+}
@@ -0,0 +1,248 @@
+package casbinbunadapter
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	// pgMaxIdentifierLength is maximum length of PostgreSQL identifier in bytes (NAMEDATALEN - 1). Longer ones are truncated silently
+	pgMaxIdentifierLength = 63
+)
+
+var (
+	// ErrInvalidIdentifier is returned when name from MatcherOptions or TriggerOptions can not be used safely
+	ErrInvalidIdentifier = errors.New("Invalid identifier")
+)
+
+// validateIdentifier checks name which is going to be quoted. Field is used for error message only
+func validateIdentifier(field, name string) error {
+	if name == "" {
+		return errors.Wrapf(ErrInvalidIdentifier, "%s is empty", field)
+	}
+	if !utf8.ValidString(name) {
+		return errors.Wrapf(ErrInvalidIdentifier, "%s '%s' is not valid UTF-8 string", field, name)
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return errors.Wrapf(ErrInvalidIdentifier, "%s '%s' contains zero byte", field, name)
+	}
+	return nil
+}
+
+// validateColumn checks column name. Dots are not allowed since query builder treats them as separators of qualified name
+func validateColumn(field, name string) error {
+	err := validateIdentifier(field, name)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(name, ".") {
+		return errors.Wrapf(ErrInvalidIdentifier, "%s '%s' contains dot", field, name)
+	}
+	return nil
+}
+
+// validatePgIdentifierLength checks that PostgreSQL will not truncate the name
+func validatePgIdentifierLength(field, name string) error {
+	if len(name) > pgMaxIdentifierLength {
+		return errors.Wrapf(ErrInvalidIdentifier, "%s '%s' is longer than %d bytes", field, name, pgMaxIdentifierLength)
+	}
+	return nil
+}
+
+// Validate checks names of schema, table and columns. Empty names are allowed since they are replaced with default ones by WithMatcherOptions()
+func (opts MatcherOptions) Validate() error {
+	tables := []struct {
+		field string
+		name  string
+	}{
+		{"MatcherOptions.SchemaName", opts.SchemaName},
+		{"MatcherOptions.TableName", opts.TableName},
+	}
+	for _, table := range tables {
+		if table.name == "" {
+			continue
+		}
+		err := validateIdentifier(table.field, table.name)
+		if err != nil {
+			return err
+		}
+	}
+	columns := []struct {
+		field string
+		name  string
+	}{
+		{"MatcherOptions.ID", opts.ID},
+		{"MatcherOptions.PType", opts.PType},
+		{"MatcherOptions.V0", opts.V0},
+		{"MatcherOptions.V1", opts.V1},
+		{"MatcherOptions.V2", opts.V2},
+		{"MatcherOptions.V3", opts.V3},
+		{"MatcherOptions.V4", opts.V4},
+		{"MatcherOptions.V5", opts.V5},
+		{"MatcherOptions.Tenant", opts.Tenant},
+		{"MatcherOptions.CreatedBy", opts.CreatedBy},
+		{"MatcherOptions.UpdatedBy", opts.UpdatedBy},
+		{"MatcherOptions.Reason", opts.Reason},
+		{"MatcherOptions.CreatedAt", opts.CreatedAt},
+		{"MatcherOptions.UpdatedAt", opts.UpdatedAt},
+		{"MatcherOptions.ValidFrom", opts.ValidFrom},
+		{"MatcherOptions.ValidTo", opts.ValidTo},
+		{"MatcherOptions.DeletedAt", opts.DeletedAt},
+	}
+	seen := make(map[string]string, len(columns))
+	for _, column := range columns {
+		if column.name == "" {
+			continue
+		}
+		err := validateColumn(column.field, column.name)
+		if err != nil {
+			return err
+		}
+		if field, ok := seen[column.name]; ok {
+			return errors.Wrapf(ErrInvalidIdentifier, "%s '%s' is the same as %s", column.field, column.name, field)
+		}
+		seen[column.name] = column.field
+	}
+	return nil
+}
+
+// Validate checks names of trigger, function, channel and version table. Empty names are allowed since they are replaced with default ones by WithTriggerOptions()
+func (opts TriggerOptions) Validate() error {
+	names := []struct {
+		field string
+		name  string
+	}{
+		{"TriggerOptions.Name", opts.Name},
+		{"TriggerOptions.FunctionName", opts.FunctionName},
+		{"TriggerOptions.FunctionSchemaName", opts.FunctionSchemaName},
+		{"TriggerOptions.ChannelName", opts.ChannelName},
+		{"TriggerOptions.VersionTableName", opts.VersionTableName},
+	}
+	for _, name := range names {
+		if name.name == "" {
+			continue
+		}
+		err := validateIdentifier(name.field, name.name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks MatcherOptions and TriggerOptions of the adapter. For PostgreSQL it also checks that names (including
+// finalized trigger name "$SCHEMA_NAME$_$TABLE_NAME$_$TRIGGER_NAME$") are not going to be truncated if WithIdentifierLengthCheck() is used
+func (a *BunAdapter) Validate() error {
+	err := a.matcher.Validate()
+	if err != nil {
+		return err
+	}
+	err = a.trigger.Validate()
+	if err != nil {
+		return err
+	}
+	if a.revisionTable != "" {
+		err = validateIdentifier("Revision table name", a.revisionTable)
+		if err != nil {
+			return err
+		}
+	}
+	if a.snapshotTable != "" {
+		err = validateIdentifier("Snapshot table name", a.snapshotTable)
+		if err != nil {
+			return err
+		}
+	}
+	if a.historyTable != "" {
+		err = validateIdentifier("History table name", a.historyTable)
+		if err != nil {
+			return err
+		}
+	}
+	err = a.validateTenant()
+	if err != nil {
+		return err
+	}
+	err = a.validateRLSSetting()
+	if err != nil {
+		return err
+	}
+	if !a.checkLength || a.DB == nil || a.dialectName() != dialect.PG {
+		return nil
+	}
+	names := []struct {
+		field string
+		name  string
+	}{
+		{"MatcherOptions.SchemaName", a.matcher.SchemaName},
+		{"MatcherOptions.TableName", a.matcher.TableName},
+		{"MatcherOptions.ID", a.matcher.ID},
+		{"MatcherOptions.PType", a.matcher.PType},
+		{"MatcherOptions.V0", a.matcher.V0},
+		{"MatcherOptions.V1", a.matcher.V1},
+		{"MatcherOptions.V2", a.matcher.V2},
+		{"MatcherOptions.V3", a.matcher.V3},
+		{"MatcherOptions.V4", a.matcher.V4},
+		{"MatcherOptions.V5", a.matcher.V5},
+		{"MatcherOptions.Tenant", a.matcher.Tenant},
+		{"MatcherOptions.CreatedBy", a.matcher.CreatedBy},
+		{"MatcherOptions.UpdatedBy", a.matcher.UpdatedBy},
+		{"MatcherOptions.Reason", a.matcher.Reason},
+		{"MatcherOptions.CreatedAt", a.matcher.CreatedAt},
+		{"MatcherOptions.UpdatedAt", a.matcher.UpdatedAt},
+		{"MatcherOptions.ValidFrom", a.matcher.ValidFrom},
+		{"MatcherOptions.ValidTo", a.matcher.ValidTo},
+		{"MatcherOptions.DeletedAt", a.matcher.DeletedAt},
+		{"TriggerOptions.FunctionName", a.trigger.FunctionName},
+		{"TriggerOptions.FunctionSchemaName", a.trigger.FunctionSchemaName},
+		{"TriggerOptions.ChannelName", a.trigger.ChannelName},
+		{"TriggerOptions.VersionTableName", a.trigger.VersionTableName},
+		{"Finalized trigger name", a.triggerName()},
+	}
+	for _, name := range names {
+		err = validatePgIdentifierLength(name.field, name.name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pgQuoteIdent quotes PostgreSQL identifier as quote_ident() does, but always: letter case, spaces and quotes are kept as is
+func pgQuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// pgQuoteQualified quotes schema-qualified PostgreSQL name
+func pgQuoteQualified(schema, name string) string {
+	return pgQuoteIdent(schema) + "." + pgQuoteIdent(name)
+}
+
+// pgQuoteLiteral quotes PostgreSQL string literal as quote_literal() does. Escape string syntax is used when value contains backslashes
+func pgQuoteLiteral(value string) string {
+	quoted := "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	if !strings.Contains(value, `\`) {
+		return quoted
+	}
+	return "E" + strings.ReplaceAll(quoted, `\`, `\\`)
+}
+
+// pgDollarQuote quotes body with dollar-quoting tag which does not occur in the body
+func pgDollarQuote(body string) string {
+	tag := "$function$"
+	for strings.Contains(body, tag) {
+		tag = tag[:len(tag)-1] + "_$"
+	}
+	return tag + body + tag
+}
+
+// checkOptions returns error of invalid options found on construction (see NewBunAdapter())
+func (a *BunAdapter) checkOptions() error {
+	if a.invalid != nil {
+		return errors.Wrap(a.invalid, "Invalid adapter options")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package casbinbunadapter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestQuoting$' *.go -v
+func TestQuoting(t *testing.T) {
+	assert.Equal(t, `"Policies"`, pgQuoteIdent("Policies"))
+	assert.Equal(t, `"my ""quoted"" table"`, pgQuoteIdent(`my "quoted" table`))
+	assert.Equal(t, `"dev"."a.b"`, pgQuoteQualified("dev", "a.b"))
+	adapter := newDialectAdapter(pgdialect.New())
+	assert.Equal(t, `"dev"."a.b"`, formatAppender(t, adapter, qualifiedName{schema: "dev", name: "a.b"}))
+	assert.Equal(t, `'CASBIN_UPDATE_MESSAGE'`, pgQuoteLiteral("CASBIN_UPDATE_MESSAGE"))
+	assert.Equal(t, `'x''); DROP TABLE users; --'`, pgQuoteLiteral("x'); DROP TABLE users; --"))
+	assert.Equal(t, `E'a\\b''c'`, pgQuoteLiteral(`a\b'c`))
+	assert.Equal(t, "$function$ body $function$", pgDollarQuote(" body "))
+	assert.Equal(t, "$function_$ $function$ $function_$", pgDollarQuote(" $function$ "))
+}
+
+// go test -run '^TestValidateOptions$' *.go -v
+func TestValidateOptions(t *testing.T) {
+	assert.NoError(t, MatcherOptions{}.Validate())
+	assert.NoError(t, MatcherOptions{SchemaName: "Dev Schema", TableName: `Policies "v2"`, V0: "Subject"}.Validate())
+	assert.ErrorIs(t, MatcherOptions{TableName: "bad\x00name"}.Validate(), ErrInvalidIdentifier)
+	assert.ErrorIs(t, MatcherOptions{V0: "rules.v0"}.Validate(), ErrInvalidIdentifier)
+	err := MatcherOptions{V0: "subject", V1: "subject"}.Validate()
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+	assert.Contains(t, err.Error(), "MatcherOptions.V1 'subject' is the same as MatcherOptions.V0")
+	assert.NoError(t, TriggerOptions{ChannelName: "it's channel"}.Validate())
+	assert.ErrorIs(t, TriggerOptions{ChannelName: "\xff"}.Validate(), ErrInvalidIdentifier)
+
+	/* Length limit is checked on demand only */
+	long := WithMatcherOptions(MatcherOptions{TableName: strings.Repeat("t", 60)})
+	_, err = OpenBunAdapter(newDialectAdapter(pgdialect.New()).DB, long)
+	assert.NoError(t, err)
+	_, err = OpenBunAdapter(newDialectAdapter(pgdialect.New()).DB, long, WithIdentifierLengthCheck())
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+	assert.Contains(t, err.Error(), "Finalized trigger name")
+
+	/* NewBunAdapter reports invalid options on access to the policy table */
+	invalid := NewBunAdapter(newSQLiteDB(t), WithMatcherOptions(MatcherOptions{V0: "subject", V1: "subject"}))
+	assert.ErrorIs(t, invalid.AddPolicy("p", "p", []string{"alice"}), ErrInvalidIdentifier)
+	_, err = invalid.CreateTableSQL()
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+
+	adapter, err := OpenBunAdapter(newDialectAdapter(pgdialect.New()).DB,
+		WithMatcherOptions(MatcherOptions{SchemaName: "Dev", TableName: "Casbin Policies", V0: `sub"ject`}),
+		WithTriggerOptions(TriggerOptions{ChannelName: "it's channel"}),
+	)
+	assert.NoError(t, err)
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.Trigger, `"Dev"."Casbin Policies" for each row execute function`)
+	assert.Contains(t, statements.Function, `'v0', new."sub""ject"`)
+	assert.Contains(t, statements.Function, `perform pg_notify(
+          'it''s channel',`)
+}
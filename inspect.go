@@ -0,0 +1,214 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	// functionMarkerAdapter identifies function created by this adapter
+	functionMarkerAdapter = "casbin-bun-adapter"
+	// TriggerFunctionVersion is version of the function body (payload format) generated by this adapter.
+	// Version 1 is function without version marker: payload has no "version" field. Version 3 adds "tenant", "actor" and "reason" fields.
+	// Version 4 adds "schema" and "table" fields. Version 5 adds "valid_from" and "valid_to" fields.
+	// Version 6 adds "deleted_at" field
+	TriggerFunctionVersion = 6
+)
+
+// functionMarker is stored as comment of the function
+type functionMarker struct {
+	Adapter      string            `json:"adapter"`
+	Version      int               `json:"version"`
+	Channel      string            `json:"channel"`
+	VersionTable string            `json:"version_table"`
+	Columns      map[string]string `json:"columns"`
+}
+
+func (m functionMarker) encode() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", errors.Wrap(err, "Can't encode function marker")
+	}
+	return string(data), nil
+}
+
+// decodeFunctionMarker parses function comment. Second value is false when comment is not a marker of this adapter
+func decodeFunctionMarker(comment string) (functionMarker, bool) {
+	marker := functionMarker{}
+	err := json.Unmarshal([]byte(comment), &marker)
+	if err != nil || marker.Adapter != functionMarkerAdapter {
+		return functionMarker{}, false
+	}
+	return marker, true
+}
+
+// expectedFunctionMarker returns marker for current MatcherOptions and TriggerOptions
+func (a *BunAdapter) expectedFunctionMarker() functionMarker {
+	return functionMarker{
+		Adapter:      functionMarkerAdapter,
+		Version:      TriggerFunctionVersion,
+		Channel:      a.trigger.ChannelName,
+		VersionTable: a.trigger.VersionTableName,
+		Columns: map[string]string{
+			"id":         a.matcher.ID,
+			"ptype":      a.matcher.PType,
+			"v0":         a.matcher.V0,
+			"v1":         a.matcher.V1,
+			"v2":         a.matcher.V2,
+			"v3":         a.matcher.V3,
+			"v4":         a.matcher.V4,
+			"v5":         a.matcher.V5,
+			"tenant":     a.matcher.Tenant,
+			"created_at": a.matcher.CreatedAt,
+			"updated_at": a.matcher.UpdatedAt,
+			"valid_from": a.matcher.ValidFrom,
+			"valid_to":   a.matcher.ValidTo,
+			"deleted_at": a.matcher.DeletedAt,
+		},
+	}
+}
+
+// TriggerMismatch is setting of installed function which differs from expected one
+type TriggerMismatch struct {
+	// Name of setting: "channel", "version_table" or column ("id", "ptype", "v0", ..., "tenant", "created_at", "updated_at", "valid_from", "valid_to", "deleted_at")
+	Setting   string
+	Installed string
+	Expected  string
+}
+
+// String returns human-readable description of the mismatch
+func (m TriggerMismatch) String() string {
+	return fmt.Sprintf("%s: installed '%s', expected '%s'", m.Setting, m.Installed, m.Expected)
+}
+
+// TriggerInspection is state of objects created by PrepareTrigger()
+type TriggerInspection struct {
+	FunctionExists     bool
+	TriggerExists      bool
+	VersionTableExists bool
+	// Version of installed function. It is 1 for function created before version markers were introduced and 0 if function does not exist
+	InstalledVersion int
+	// Version of function which is generated by this adapter
+	ExpectedVersion int
+	// Settings of installed function which differ from current MatcherOptions and TriggerOptions. Empty for function without marker
+	Mismatches []TriggerMismatch
+}
+
+// UpToDate returns true if every object exists and function has been generated by the same version of adapter with the same settings
+func (ti TriggerInspection) UpToDate() bool {
+	return ti.FunctionExists && ti.TriggerExists && ti.VersionTableExists && ti.InstalledVersion == ti.ExpectedVersion && len(ti.Mismatches) == 0
+}
+
+// compareFunctionMarkers returns differences of installed marker from expected one
+func compareFunctionMarkers(installed, expected functionMarker) []TriggerMismatch {
+	mismatches := []TriggerMismatch{}
+	if installed.Channel != expected.Channel {
+		mismatches = append(mismatches, TriggerMismatch{Setting: "channel", Installed: installed.Channel, Expected: expected.Channel})
+	}
+	if installed.VersionTable != expected.VersionTable {
+		mismatches = append(mismatches, TriggerMismatch{Setting: "version_table", Installed: installed.VersionTable, Expected: expected.VersionTable})
+	}
+	// Columns missing in marker of older function are compared as empty ones
+	columns := make([]string, 0, len(expected.Columns))
+	for column := range expected.Columns {
+		columns = append(columns, column)
+	}
+	for column := range installed.Columns {
+		if _, ok := expected.Columns[column]; !ok {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if installed.Columns[column] != expected.Columns[column] {
+			mismatches = append(mismatches, TriggerMismatch{Setting: column, Installed: installed.Columns[column], Expected: expected.Columns[column]})
+		}
+	}
+	return mismatches
+}
+
+// InspectTrigger reports installed and expected versions of function created by PrepareTrigger() and mismatched settings (e.g. column mapping)
+func (a *BunAdapter) InspectTrigger(ctx context.Context) (TriggerInspection, error) {
+	err := a.requireDialect("InspectTrigger", dialect.PG)
+	if err != nil {
+		return TriggerInspection{}, err
+	}
+	err = a.Validate()
+	if err != nil {
+		return TriggerInspection{}, err
+	}
+	return a.inspectTrigger(ctx, a.DB)
+}
+
+func (a *BunAdapter) inspectTrigger(ctx context.Context, db bun.IDB) (TriggerInspection, error) {
+	inspection := TriggerInspection{ExpectedVersion: TriggerFunctionVersion}
+	functionName := a.functionIdent() + "()"
+	var comment sql.NullString
+	err := db.QueryRowContext(ctx,
+		"SELECT to_regprocedure(?) IS NOT NULL, obj_description(to_regprocedure(?), 'pg_proc')",
+		functionName, functionName,
+	).Scan(&inspection.FunctionExists, &comment)
+	if err != nil {
+		return inspection, errors.Wrapf(err, "Can't inspect function %s", functionName)
+	}
+	err = db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = ? AND tgrelid = to_regclass(?))",
+		a.triggerName(), pgQuoteQualified(a.matcher.SchemaName, a.matcher.TableName),
+	).Scan(&inspection.TriggerExists)
+	if err != nil {
+		return inspection, errors.Wrapf(err, "Can't inspect trigger %s", a.triggerName())
+	}
+	err = db.QueryRowContext(ctx,
+		"SELECT to_regclass(?) IS NOT NULL",
+		a.versionTableIdent(),
+	).Scan(&inspection.VersionTableExists)
+	if err != nil {
+		return inspection, errors.Wrapf(err, "Can't inspect table %s", a.versionTableIdent())
+	}
+	if !inspection.FunctionExists {
+		return inspection, nil
+	}
+	marker, ok := decodeFunctionMarker(comment.String)
+	if !ok {
+		inspection.InstalledVersion = 1
+		return inspection, nil
+	}
+	inspection.InstalledVersion = marker.Version
+	inspection.Mismatches = compareFunctionMarkers(marker, a.expectedFunctionMarker())
+	return inspection, nil
+}
+
+// UpgradeTrigger replaces function and trigger created by PrepareTrigger() (or creates missing ones) in single transaction.
+// Function is replaced via CREATE OR REPLACE and trigger is recreated within the same transaction, so concurrent writes never miss it. Returns inspection made after upgrade
+func (a *BunAdapter) UpgradeTrigger(ctx context.Context) (TriggerInspection, error) {
+	err := a.requireDialect("UpgradeTrigger", dialect.PG)
+	if err != nil {
+		return TriggerInspection{}, err
+	}
+	statements, err := a.triggerStatements(true, false)
+	if err != nil {
+		return TriggerInspection{}, err
+	}
+	var inspection TriggerInspection
+	err = a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, statement := range []string{statements.VersionTable, statements.Function, statements.FunctionComment, statements.DropTrigger, statements.Trigger} {
+			_, err := tx.ExecContext(ctx, statement)
+			if err != nil {
+				return errors.Wrapf(err, "Can't execute statement '%s'", statement)
+			}
+		}
+		inspection, err = a.inspectTrigger(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return TriggerInspection{}, errors.Wrap(err, "Can't upgrade trigger")
+	}
+	return inspection, nil
+}
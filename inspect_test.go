@@ -0,0 +1,55 @@
+package casbinbunadapter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestFunctionMarker$' *.go -v
+func TestFunctionMarker(t *testing.T) {
+	installed := newDialectAdapter(pgdialect.New())
+	comment, err := installed.expectedFunctionMarker().encode()
+	assert.NoError(t, err)
+	marker, ok := decodeFunctionMarker(comment)
+	assert.True(t, ok)
+	assert.Equal(t, TriggerFunctionVersion, marker.Version)
+	assert.Empty(t, compareFunctionMarkers(marker, installed.expectedFunctionMarker()))
+
+	_, ok = decodeFunctionMarker("Function created by DBA")
+	assert.False(t, ok)
+	_, ok = decodeFunctionMarker(`{"adapter": "other"}`)
+	assert.False(t, ok)
+
+	changed := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{V1: "haha"}), WithTriggerOptions(TriggerOptions{ChannelName: "custom_ch_name"}))
+	mismatches := compareFunctionMarkers(marker, changed.expectedFunctionMarker())
+	assert.Equal(t, []TriggerMismatch{
+		{Setting: "channel", Installed: defaultTriggerOpts.ChannelName, Expected: "custom_ch_name"},
+		{Setting: "v1", Installed: defaultMatcherOpts.V1, Expected: "haha"},
+	}, mismatches)
+
+	/* Function created before validity window support */
+	validity := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{ValidFrom: "valid_from", ValidTo: "valid_to"}))
+	legacy := installed.expectedFunctionMarker()
+	delete(legacy.Columns, "valid_from")
+	delete(legacy.Columns, "valid_to")
+	assert.Equal(t, []TriggerMismatch{
+		{Setting: "valid_from", Installed: "", Expected: "valid_from"},
+		{Setting: "valid_to", Installed: "", Expected: "valid_to"},
+	}, compareFunctionMarkers(legacy, validity.expectedFunctionMarker()))
+	assert.Empty(t, compareFunctionMarkers(legacy, installed.expectedFunctionMarker()))
+
+	/* Function created before soft delete support */
+	softDelete := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{DeletedAt: "deleted_at", ValidTo: "valid_to"}))
+	legacy = installed.expectedFunctionMarker()
+	delete(legacy.Columns, "deleted_at")
+	assert.Equal(t, []TriggerMismatch{
+		{Setting: "deleted_at", Installed: "", Expected: "deleted_at"},
+		{Setting: "valid_to", Installed: "", Expected: "valid_to"},
+	}, compareFunctionMarkers(legacy, softDelete.expectedFunctionMarker()))
+
+	statements, err := changed.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.FunctionComment, `COMMENT ON FUNCTION "public"."update_policies_table"() IS '{"adapter":"casbin-bun-adapter","version":6`)
+}
@@ -0,0 +1,288 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+var (
+	// ErrTableMismatch is returned by ValidateTable() when policy table does not match MatcherOptions
+	ErrTableMismatch = errors.New("Policy table does not match MatcherOptions")
+)
+
+// ColumnReport describes mapped column of the policy table
+type ColumnReport struct {
+	// Field of MatcherOptions, e.g. "MatcherOptions.V1"
+	Field string
+	// Column name
+	Name   string
+	Exists bool
+	// Data type reported by database. Empty if column does not exist
+	DataType string
+	// If data type is compatible with Casbin value: integer for ID, timestamp for CreatedAt, UpdatedAt, ValidFrom, ValidTo and DeletedAt and string for other columns
+	Compatible bool
+}
+
+// TableReport is result of IntrospectTable()
+type TableReport struct {
+	Schema  string
+	Table   string
+	Exists  bool
+	Columns []ColumnReport
+	// Name of unique constraint covering ptype and value columns (or generated rule hash column). Empty if there is no such constraint
+	UniqueConstraint string
+	// Human-readable problems. Empty when table matches MatcherOptions
+	Problems []string
+}
+
+// OK returns true if table matches MatcherOptions
+func (r TableReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns ErrTableMismatch with problems listed or nil if table matches MatcherOptions
+func (r TableReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return errors.Wrap(ErrTableMismatch, strings.Join(r.Problems, "; "))
+}
+
+// tableColumn is row of information_schema.columns
+type tableColumn struct {
+	Name     string `bun:"column_name"`
+	DataType string `bun:"data_type"`
+}
+
+// uniqueColumn is column of unique (or primary key) constraint
+type uniqueColumn struct {
+	Constraint string `bun:"constraint_name"`
+	Column     string `bun:"column_name"`
+}
+
+// IntrospectTable reads information_schema (pragma functions for SQLite) and checks that every column of MatcherOptions exists
+// with compatible type and that unique constraint covering ptype and value columns is present.
+// Unique indexes which are not constraints are not visible in information_schema of PostgreSQL, so they are reported as missing constraint
+func (a *BunAdapter) IntrospectTable(ctx context.Context) (TableReport, error) {
+	report := TableReport{Schema: a.tableSchema(), Table: a.matcher.TableName}
+	columns, err := a.readTableColumns(ctx)
+	if err != nil {
+		return report, errors.Wrapf(err, "Can't read columns of table '%s'", a.matcher.TableName)
+	}
+	report.Exists = len(columns) > 0
+	if !report.Exists {
+		report.Problems = append(report.Problems, fmt.Sprintf("table '%s' does not exist", a.matcher.TableName))
+		return report, nil
+	}
+	for _, mapped := range a.mappedColumns() {
+		if mapped.kind == columnInteger && a.compat.withoutID {
+			continue
+		}
+		column := ColumnReport{Field: mapped.field, Name: mapped.name}
+		for _, existing := range columns {
+			if a.sameIdentifier(existing.Name, mapped.name) {
+				column.Exists = true
+				column.DataType = existing.DataType
+				break
+			}
+		}
+		switch {
+		case !column.Exists:
+			report.Problems = append(report.Problems, fmt.Sprintf("column '%s' (%s) does not exist", column.Name, column.Field))
+		case mapped.kind == columnInteger:
+			column.Compatible = isIntegerType(column.DataType)
+		case mapped.kind == columnTimestamp:
+			column.Compatible = isTimestampType(column.DataType)
+		default:
+			column.Compatible = isStringType(column.DataType)
+		}
+		if column.Exists && !column.Compatible {
+			report.Problems = append(report.Problems, fmt.Sprintf("column '%s' (%s) has incompatible type '%s'", column.Name, column.Field, column.DataType))
+		}
+		report.Columns = append(report.Columns, column)
+	}
+	uniqueColumns, err := a.readUniqueColumns(ctx)
+	if err != nil {
+		return report, errors.Wrapf(err, "Can't read unique constraints of table '%s'", a.matcher.TableName)
+	}
+	report.UniqueConstraint = a.findRuleConstraint(uniqueColumns)
+	if report.UniqueConstraint == "" && (!a.compat.enabled() || a.compat.uniqueRule) {
+		report.Problems = append(report.Problems, fmt.Sprintf("there is no unique constraint covering exactly columns (%s)", strings.Join(a.ruleColumns(), ", ")))
+	}
+	return report, nil
+}
+
+// ValidateTable returns ErrTableMismatch describing problems found by IntrospectTable()
+func (a *BunAdapter) ValidateTable(ctx context.Context) error {
+	report, err := a.IntrospectTable(ctx)
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// columnKind is expected kind of column data type
+type columnKind int
+
+const (
+	columnString columnKind = iota
+	columnInteger
+	columnTimestamp
+)
+
+// mappedColumn is column from MatcherOptions
+type mappedColumn struct {
+	field string
+	name  string
+	kind  columnKind
+}
+
+func (a *BunAdapter) mappedColumns() []mappedColumn {
+	columns := []mappedColumn{
+		{"MatcherOptions.ID", a.matcher.ID, columnInteger},
+		{"MatcherOptions.PType", a.matcher.PType, columnString},
+		{"MatcherOptions.V0", a.matcher.V0, columnString},
+		{"MatcherOptions.V1", a.matcher.V1, columnString},
+		{"MatcherOptions.V2", a.matcher.V2, columnString},
+		{"MatcherOptions.V3", a.matcher.V3, columnString},
+		{"MatcherOptions.V4", a.matcher.V4, columnString},
+		{"MatcherOptions.V5", a.matcher.V5, columnString},
+	}
+	optional := []mappedColumn{
+		{"MatcherOptions.Tenant", a.matcher.Tenant, columnString},
+		{"MatcherOptions.CreatedBy", a.matcher.CreatedBy, columnString},
+		{"MatcherOptions.UpdatedBy", a.matcher.UpdatedBy, columnString},
+		{"MatcherOptions.Reason", a.matcher.Reason, columnString},
+		{"MatcherOptions.CreatedAt", a.matcher.CreatedAt, columnTimestamp},
+		{"MatcherOptions.UpdatedAt", a.matcher.UpdatedAt, columnTimestamp},
+		{"MatcherOptions.ValidFrom", a.matcher.ValidFrom, columnTimestamp},
+		{"MatcherOptions.ValidTo", a.matcher.ValidTo, columnTimestamp},
+		{"MatcherOptions.DeletedAt", a.matcher.DeletedAt, columnTimestamp},
+	}
+	for _, column := range optional {
+		if column.name != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// sameIdentifier compares names. Names are case sensitive for PostgreSQL only
+func (a *BunAdapter) sameIdentifier(x, y string) bool {
+	if a.dialectName() == dialect.PG {
+		return x == y
+	}
+	return strings.EqualFold(x, y)
+}
+
+// schemaCondition returns value for comparing with table_schema of information_schema. MySQL uses current database when schema is not set
+func (a *BunAdapter) schemaCondition() interface{} {
+	schema := a.tableSchema()
+	if schema == "" && a.dialectName() == dialect.MySQL {
+		return bun.Safe("DATABASE()")
+	}
+	return schema
+}
+
+func (a *BunAdapter) readTableColumns(ctx context.Context) ([]tableColumn, error) {
+	columns := []tableColumn{}
+	var err error
+	switch a.dialectName() {
+	case dialect.SQLite:
+		err = a.NewRaw("SELECT name AS column_name, type AS data_type FROM pragma_table_info(?)", a.matcher.TableName).Scan(ctx, &columns)
+	default:
+		err = a.NewRaw(
+			"SELECT column_name AS column_name, data_type AS data_type FROM information_schema.columns WHERE table_schema = ? AND table_name = ?",
+			a.schemaCondition(), a.matcher.TableName,
+		).Scan(ctx, &columns)
+	}
+	return columns, err
+}
+
+func (a *BunAdapter) readUniqueColumns(ctx context.Context) ([]uniqueColumn, error) {
+	columns := []uniqueColumn{}
+	var err error
+	switch a.dialectName() {
+	case dialect.SQLite:
+		err = a.NewRaw(
+			`SELECT il.name AS constraint_name, ii.name AS column_name FROM pragma_index_list(?) AS il JOIN pragma_index_info(il.name) AS ii WHERE il."unique" = 1`,
+			a.matcher.TableName,
+		).Scan(ctx, &columns)
+	default:
+		err = a.NewRaw(`SELECT tc.constraint_name AS constraint_name, kcu.column_name AS column_name
+FROM information_schema.table_constraints AS tc
+JOIN information_schema.key_column_usage AS kcu
+  ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_name = tc.table_name
+WHERE tc.table_schema = ? AND tc.table_name = ? AND tc.constraint_type IN ('UNIQUE', 'PRIMARY KEY')`,
+			a.schemaCondition(), a.matcher.TableName,
+		).Scan(ctx, &columns)
+	}
+	return columns, err
+}
+
+// findRuleConstraint returns name of constraint which columns are exactly tenant, ptype and value columns (or generated rule hash column)
+func (a *BunAdapter) findRuleConstraint(uniqueColumns []uniqueColumn) string {
+	constraints := map[string][]string{}
+	for _, column := range uniqueColumns {
+		constraints[column.Constraint] = append(constraints[column.Constraint], column.Column)
+	}
+	names := make([]string, 0, len(constraints))
+	for name := range constraints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	expected := a.ruleColumns()
+	for _, name := range names {
+		columns := constraints[name]
+		if len(columns) == 1 && a.sameIdentifier(columns[0], ruleHashColumn) {
+			return name
+		}
+		if a.sameColumnSet(columns, expected) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (a *BunAdapter) sameColumnSet(columns, expected []string) bool {
+	if len(columns) != len(expected) {
+		return false
+	}
+	for _, want := range expected {
+		found := false
+		for _, column := range columns {
+			if a.sameIdentifier(column, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isIntegerType checks data type reported by information_schema (or declared type for SQLite)
+func isIntegerType(dataType string) bool {
+	return strings.Contains(strings.ToLower(dataType), "int")
+}
+
+// isTimestampType checks data type reported by information_schema (or declared type for SQLite)
+func isTimestampType(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	return strings.Contains(dataType, "time") || strings.Contains(dataType, "date")
+}
+
+// isStringType checks data type reported by information_schema (or declared type for SQLite).
+// Types of extensions (e.g. citext) are reported as "USER-DEFINED" by PostgreSQL, so they are accepted too
+func isStringType(dataType string) bool {
+	dataType = strings.ToLower(dataType)
+	return strings.Contains(dataType, "char") || strings.Contains(dataType, "text") || dataType == "user-defined"
+}
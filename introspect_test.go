@@ -0,0 +1,50 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestIntrospectTable$' *.go -v
+func TestIntrospectTable(t *testing.T) {
+	ctx := context.Background()
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "introspected_policies"}))
+	report, err := adapter.IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.True(t, report.Exists)
+	assert.Len(t, report.Columns, 8)
+	// SQLite names index of the constraint by itself
+	assert.Equal(t, "sqlite_autoindex_introspected_policies_1", report.UniqueConstraint)
+	assert.NoError(t, adapter.ValidateTable(ctx))
+
+	// Typo in column mapping
+	typo := NewBunAdapter(adapter.DB, WithMatcherOptions(MatcherOptions{TableName: "introspected_policies", V1: "haha"}))
+	report, err = typo.IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.False(t, report.Columns[3].Exists)
+	assert.Equal(t, []string{
+		"column 'haha' (MatcherOptions.V1) does not exist",
+		"there is no unique constraint covering exactly columns (ptype, v0, haha, v2, v3, v4, v5)",
+	}, report.Problems)
+	assert.ErrorIs(t, typo.ValidateTable(ctx), ErrTableMismatch)
+
+	// Incompatible type and missing unique constraint
+	_, err = adapter.ExecContext(ctx, "CREATE TABLE bad_policies (id TEXT, ptype varchar(2), v0 varchar(256), v1 varchar(256), v2 varchar(256), v3 varchar(256), v4 varchar(256), v5 INTEGER)")
+	assert.NoError(t, err)
+	report, err = NewBunAdapter(adapter.DB, WithMatcherOptions(MatcherOptions{TableName: "bad_policies"})).IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"column 'id' (MatcherOptions.ID) has incompatible type 'TEXT'",
+		"column 'v5' (MatcherOptions.V5) has incompatible type 'INTEGER'",
+		"there is no unique constraint covering exactly columns (ptype, v0, v1, v2, v3, v4, v5)",
+	}, report.Problems)
+
+	report, err = NewBunAdapter(adapter.DB, WithMatcherOptions(MatcherOptions{TableName: "missing_policies"})).IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.False(t, report.Exists)
+	assert.Equal(t, []string{"table 'missing_policies' does not exist"}, report.Problems)
+}
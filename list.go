@@ -0,0 +1,147 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// PolicyRecord is row of the policy table along with optional columns of MatcherOptions. See ListPolicies()
+type PolicyRecord struct {
+	// Zero for table without ID column
+	ID    int
+	PType string
+	Rule  []string
+	// Empty if MatcherOptions.Tenant is not set
+	Tenant string
+	// Nil if column is not set in MatcherOptions or it holds NULL (e.g. row has been inserted bypassing adapter)
+	CreatedAt *time.Time
+	UpdatedAt *time.Time
+	CreatedBy string
+	UpdatedBy string
+	Reason    string
+	// Nil if column is not set in MatcherOptions or the window is unbounded
+	ValidFrom *time.Time
+	ValidTo   *time.Time
+	// Nil for rows which are not soft-deleted
+	DeletedAt *time.Time
+}
+
+// ListFilter is for selecting rows of the policy table. Empty fields are not used
+type ListFilter struct {
+	PType string
+	// Same as arguments of RemoveFilteredPolicy(). PType must be set for using them
+	FieldIndex  int
+	FieldValues []string
+	// Only rows changed before the time, e.g. for finding stale grants. MatcherOptions.UpdatedAt (or MatcherOptions.CreatedAt) column must be set
+	UpdatedBefore time.Time
+	// If soft-deleted rows needed to be listed instead of live ones. MatcherOptions.DeletedAt must be set
+	Deleted bool
+	// Maximum number of rows. Zero means no limit
+	Limit int
+}
+
+// policyRecordRow is row of the policy table with canonical names of columns
+type policyRecordRow struct {
+	ID        int        `bun:"id"`
+	PType     string     `bun:"ptype"`
+	V0        string     `bun:"v0"`
+	V1        string     `bun:"v1"`
+	V2        string     `bun:"v2"`
+	V3        string     `bun:"v3"`
+	V4        string     `bun:"v4"`
+	V5        string     `bun:"v5"`
+	CreatedAt *time.Time `bun:"created_at"`
+	UpdatedAt *time.Time `bun:"updated_at"`
+	CreatedBy string     `bun:"created_by"`
+	UpdatedBy string     `bun:"updated_by"`
+	Reason    string     `bun:"reason"`
+	ValidFrom *time.Time `bun:"valid_from"`
+	ValidTo   *time.Time `bun:"valid_to"`
+	DeletedAt *time.Time `bun:"deleted_at"`
+}
+
+// ListPolicies returns rows of the policy table (of current tenant if MatcherOptions.Tenant is set) matching the filter.
+// Unlike LoadPolicy() it exposes optional columns: timestamps, change metadata and validity window. Rules which are not valid now are listed too. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) ListPolicies(ctx context.Context, filter ListFilter) ([]PolicyRecord, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Deleted && !a.softDelete() {
+		return nil, errors.Wrap(ErrSoftDeleteNotSet, "Can't list soft-deleted policies")
+	}
+	timeColumn := a.matcher.UpdatedAt
+	if timeColumn == "" {
+		timeColumn = a.matcher.CreatedAt
+	}
+	if !filter.UpdatedBefore.IsZero() && timeColumn == "" {
+		return nil, errors.New("Filtering by time requires MatcherOptions.UpdatedAt or MatcherOptions.CreatedAt column")
+	}
+	var rows []policyRecordRow
+	err = a.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		query := a.policyColumns(db.NewSelect().
+			Model(&rows).
+			ModelTableExpr("? as t", a.policyTable()))
+		for _, column := range []struct {
+			alias string
+			name  string
+		}{
+			{"created_at", a.matcher.CreatedAt},
+			{"updated_at", a.matcher.UpdatedAt},
+			{"created_by", a.matcher.CreatedBy},
+			{"updated_by", a.matcher.UpdatedBy},
+			{"reason", a.matcher.Reason},
+			{"valid_from", a.matcher.ValidFrom},
+			{"valid_to", a.matcher.ValidTo},
+			{"deleted_at", a.matcher.DeletedAt},
+		} {
+			if column.name != "" {
+				query = query.ColumnExpr("? as ?", bun.Name(column.name), bun.Ident(column.alias))
+			}
+		}
+		query = query.ApplyQueryBuilder(a.scopeTenant)
+		if filter.Deleted {
+			query = query.Where("? IS NOT NULL", bun.Name(a.matcher.DeletedAt))
+		} else {
+			query = query.ApplyQueryBuilder(a.scopeLive)
+		}
+		if filter.PType != "" {
+			query = query.ApplyQueryBuilder(a.fieldFilter(filter.PType, filter.FieldIndex, filter.FieldValues...))
+		}
+		if !filter.UpdatedBefore.IsZero() {
+			query = query.Where("? < ?", bun.Name(timeColumn), filter.UpdatedBefore.UTC())
+		}
+		if !a.compat.withoutID {
+			query = query.OrderExpr("? ASC", bun.Name(a.matcher.ID))
+		}
+		if filter.Limit > 0 {
+			query = query.Limit(filter.Limit)
+		}
+		return query.Scan(ctx)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't list policies")
+	}
+	records := make([]PolicyRecord, 0, len(rows))
+	for _, row := range rows {
+		policy := CasbinPolicy{ID: row.ID, PType: row.PType, V0: row.V0, V1: row.V1, V2: row.V2, V3: row.V3, V4: row.V4, V5: row.V5}
+		records = append(records, PolicyRecord{
+			ID:        row.ID,
+			PType:     row.PType,
+			Rule:      a.ruleDefinition(policy),
+			Tenant:    a.tenant,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			CreatedBy: row.CreatedBy,
+			UpdatedBy: row.UpdatedBy,
+			Reason:    row.Reason,
+			ValidFrom: row.ValidFrom,
+			ValidTo:   row.ValidTo,
+			DeletedAt: row.DeletedAt,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,142 @@
+package casbinbunadapter
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/pkg/errors"
+)
+
+// EnforcerManager keeps one enforcer per policy table picked by resolver (see WithSchemaResolver()).
+// Least recently used enforcers are evicted when capacity is exceeded
+type EnforcerManager struct {
+	adapter   *BunAdapter
+	modelText string
+	capacity  int
+	onEvict   func(key string, enforcer *casbin.SyncedEnforcer)
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[routingKey]*list.Element
+	// Enforcers being created and loaded. Lock is not held during loading, so tables do not wait for each other
+	loading map[routingKey]*enforcerLoad
+}
+
+type managedEnforcer struct {
+	key      routingKey
+	enforcer *casbin.SyncedEnforcer
+}
+
+// enforcerLoad is result of enforcer creation shared by concurrent calls for the same table. Done is closed when it is ready
+type enforcerLoad struct {
+	done     chan struct{}
+	enforcer *casbin.SyncedEnforcer
+	err      error
+}
+
+// NewEnforcerManager returns new *EnforcerManager. Every enforcer is created from the model text and loaded via adapter bound to resolved table.
+// Non-positive capacity means no eviction
+func NewEnforcerManager(adapter *BunAdapter, modelText string, capacity int, opts ...func(*EnforcerManager)) *EnforcerManager {
+	m := &EnforcerManager{
+		adapter:   adapter,
+		modelText: modelText,
+		capacity:  capacity,
+		order:     list.New(),
+		entries:   map[routingKey]*list.Element{},
+		loading:   map[routingKey]*enforcerLoad{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// WithEvictionHook sets function which is called for every evicted enforcer (e.g. for stopping its listener). Key is "$SCHEMA_NAME$.$TABLE_NAME$".
+// Hook is called with lock held, so it must not call methods of the manager
+func WithEvictionHook(hook func(key string, enforcer *casbin.SyncedEnforcer)) func(*EnforcerManager) {
+	return func(m *EnforcerManager) {
+		m.onEvict = hook
+	}
+}
+
+// Enforcer returns enforcer for table picked by resolver for the context. Enforcer is created and loaded on first use.
+// Concurrent calls for the same table share single loading
+func (m *EnforcerManager) Enforcer(ctx context.Context) (*casbin.SyncedEnforcer, error) {
+	target, err := m.adapter.resolveTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := routingKey{schema: target.matcher.SchemaName, table: target.matcher.TableName}
+	m.mu.Lock()
+	if elem, ok := m.entries[key]; ok {
+		m.order.MoveToFront(elem)
+		m.mu.Unlock()
+		return elem.Value.(*managedEnforcer).enforcer, nil
+	}
+	if load, ok := m.loading[key]; ok {
+		m.mu.Unlock()
+		select {
+		case <-load.done:
+			return load.enforcer, load.err
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "Can't wait for enforcer of policy table '%s'", key)
+		}
+	}
+	load := &enforcerLoad{done: make(chan struct{})}
+	m.loading[key] = load
+	m.mu.Unlock()
+
+	load.enforcer, load.err = m.newEnforcer(target, key)
+	m.mu.Lock()
+	delete(m.loading, key)
+	if load.err == nil {
+		m.entries[key] = m.order.PushFront(&managedEnforcer{key: key, enforcer: load.enforcer})
+		for m.capacity > 0 && m.order.Len() > m.capacity {
+			m.evict(m.order.Back())
+		}
+	}
+	m.mu.Unlock()
+	close(load.done)
+	return load.enforcer, load.err
+}
+
+func (m *EnforcerManager) newEnforcer(target *BunAdapter, key routingKey) (*casbin.SyncedEnforcer, error) {
+	mdl, err := model.NewModelFromString(m.modelText)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't parse model")
+	}
+	enforcer, err := casbin.NewSyncedEnforcer(mdl, target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't create enforcer for policy table '%s'", key)
+	}
+	return enforcer, nil
+}
+
+// Evict removes enforcer of the table. Next call of Enforcer() creates and loads new one
+func (m *EnforcerManager) Evict(schemaName, tableName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[routingKey{schema: schemaName, table: tableName}]; ok {
+		m.evict(elem)
+	}
+}
+
+// Len returns number of kept enforcers
+func (m *EnforcerManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// evict removes enforcer along with adapter bound to its table, so memory is bounded by capacity
+func (m *EnforcerManager) evict(elem *list.Element) {
+	entry := m.order.Remove(elem).(*managedEnforcer)
+	delete(m.entries, entry.key)
+	m.adapter.forgetTarget(entry.key)
+	if m.onEvict != nil {
+		m.onEvict(entry.key.String(), entry.enforcer)
+	}
+}
@@ -0,0 +1,113 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	// actorSettingName and reasonSettingName pass ChangeMetadata to the trigger function. See TriggerDataPayload
+	actorSettingName  = "casbin.actor"
+	reasonSettingName = "casbin.reason"
+)
+
+// WithDefaultChangeMetadata sets metadata which is used when context has no one (or some of its fields are empty). See WithChangeMetadata()
+func WithDefaultChangeMetadata(metadata ChangeMetadata) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.defaultMetadata = metadata
+	}
+}
+
+// changeMetadata returns metadata of the context completed by default one
+func (a *BunAdapter) changeMetadata(ctx context.Context) ChangeMetadata {
+	metadata := ChangeMetadataFrom(ctx)
+	if metadata.Actor == "" {
+		metadata.Actor = a.defaultMetadata.Actor
+	}
+	if metadata.Reason == "" {
+		metadata.Reason = a.defaultMetadata.Reason
+	}
+	return metadata
+}
+
+// setMetadataSettings exposes metadata to the trigger function within the transaction. PostgreSQL only
+func (a *BunAdapter) setMetadataSettings(ctx context.Context, tx bun.Tx) error {
+	if a.dialectName() != dialect.PG {
+		return nil
+	}
+	metadata := a.changeMetadata(ctx)
+	if metadata.Actor == "" && metadata.Reason == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "SELECT set_config(?, ?, true), set_config(?, ?, true)", actorSettingName, metadata.Actor, reasonSettingName, metadata.Reason)
+	if err != nil {
+		return errors.Wrap(err, "Can't set change metadata")
+	}
+	return nil
+}
+
+// applyMetadataColumns puts metadata into optional columns (MatcherOptions.CreatedBy, UpdatedBy and Reason) of inserted or updated row.
+// CreatedBy is kept as is for updated row
+func (a *BunAdapter) applyMetadataColumns(ctx context.Context, values map[string]interface{}, inserting bool) map[string]interface{} {
+	metadata := a.changeMetadata(ctx)
+	for _, column := range []struct {
+		name  string
+		value string
+	}{
+		{a.matcher.CreatedBy, metadata.Actor},
+		{a.matcher.UpdatedBy, metadata.Actor},
+		{a.matcher.Reason, metadata.Reason},
+	} {
+		if column.name == "" || (!inserting && column.name == a.matcher.CreatedBy) {
+			continue
+		}
+		if column.value == "" {
+			values[column.name] = nil
+		} else {
+			values[column.name] = column.value
+		}
+	}
+	return values
+}
+
+// applyTimestampColumns puts time into optional columns (MatcherOptions.CreatedAt and UpdatedAt) of inserted or updated row.
+// CreatedAt is kept as is for updated row
+func (a *BunAdapter) applyTimestampColumns(values map[string]interface{}, now time.Time, inserting bool) map[string]interface{} {
+	if a.matcher.CreatedAt != "" && inserting {
+		values[a.matcher.CreatedAt] = now
+	}
+	if a.matcher.UpdatedAt != "" {
+		values[a.matcher.UpdatedAt] = now
+	}
+	return values
+}
+
+// metadataColumns returns DDL of optional metadata, timestamp, validity and soft delete columns
+func (a *BunAdapter) metadataColumns(actorType, reasonType, timestampType string) ([]string, []interface{}) {
+	lines := []string{}
+	args := []interface{}{}
+	for _, column := range []struct {
+		name string
+		ddl  string
+	}{
+		{a.matcher.CreatedBy, actorType},
+		{a.matcher.UpdatedBy, actorType},
+		{a.matcher.Reason, reasonType},
+		{a.matcher.CreatedAt, timestampType},
+		{a.matcher.UpdatedAt, timestampType},
+		{a.matcher.ValidFrom, timestampType},
+		{a.matcher.ValidTo, timestampType},
+		{a.matcher.DeletedAt, timestampType},
+	} {
+		if column.name == "" {
+			continue
+		}
+		lines = append(lines, "? "+column.ddl)
+		args = append(args, bun.Name(column.name))
+	}
+	return lines, args
+}
@@ -0,0 +1,61 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestChangeMetadata$' *.go -v
+func TestChangeMetadata(t *testing.T) {
+	matcher := MatcherOptions{TableName: "metadata_policies", CreatedBy: "created_by", UpdatedBy: "updated_by", Reason: "reason"}
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(matcher), WithDefaultChangeMetadata(ChangeMetadata{Actor: "system"}))
+	ctx := context.Background()
+
+	assert.NoError(t, adapter.AddPolicyCtx(WithChangeMetadata(ctx, ChangeMetadata{Actor: "alice", Reason: "TICKET-1"}), "p", "p", []string{"bob", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data1", "read", "allow"}))
+
+	var rows []struct {
+		V0        string  `bun:"v0"`
+		CreatedBy string  `bun:"created_by"`
+		UpdatedBy string  `bun:"updated_by"`
+		Reason    *string `bun:"reason"`
+	}
+	err := adapter.NewSelect().TableExpr("metadata_policies").Column("v0", "created_by", "updated_by", "reason").Order("v0").Scan(ctx, &rows)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "alice", rows[0].CreatedBy)
+		assert.Equal(t, "alice", rows[0].UpdatedBy)
+		assert.Equal(t, "TICKET-1", *rows[0].Reason)
+		// Default metadata is used for context without metadata
+		assert.Equal(t, "system", rows[1].CreatedBy)
+		assert.Nil(t, rows[1].Reason)
+	}
+
+	report, err := adapter.IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+}
+
+// go test -run '^TestChangeMetadataSQL$' *.go -v
+func TestChangeMetadataSQL(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{CreatedBy: "created_by", Reason: "reason"}))
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, ddl, `"created_by" varchar(256) NULL`)
+	assert.Contains(t, ddl, `"reason" text NULL`)
+
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.Function, `'actor', nullif(current_setting('casbin.actor', true), '')`)
+	assert.Contains(t, statements.Function, `'reason', nullif(current_setting('casbin.reason', true), '')`)
+
+	// Metadata columns are inserted, but they are not part of the rule
+	mssql := newDialectAdapter(mssqlTestDialect{pgdialect.New()}, WithMatcherOptions(MatcherOptions{CreatedBy: "created_by"}))
+	values := mssql.insertValues(WithChangeMetadata(context.Background(), ChangeMetadata{Actor: "alice"}), NewCasbinPolicyFrom("p", []string{"bob"}))
+	query := formatAppender(t, mssql, mssql.newMSSQLIgnoringInsert(mssql.DB, values))
+	assert.Contains(t, query, `INSERT INTO "dbo"."casbin_policy" ("ptype", "v0", "v1", "v2", "v3", "v4", "v5", "created_by") VALUES ('p', 'bob', '', '', '', '', '', 'alice')`)
+	assert.NotContains(t, query, `"created_by" = 'alice'`)
+}
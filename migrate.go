@@ -0,0 +1,107 @@
+package casbinbunadapter
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	tableMigrationComment   = "casbin_policy_table"
+	triggerMigrationComment = "casbin_policy_trigger"
+)
+
+// TableMigration returns bun migration which creates policy table (see CreateTableSQL()) on up and drops it on down
+func (a *BunAdapter) TableMigration(name string) migrate.Migration {
+	return migrate.Migration{
+		Name:    name,
+		Comment: tableMigrationComment,
+		Up: func(ctx context.Context, db *bun.DB) error {
+			ddl, err := a.CreateTableSQL()
+			if err != nil {
+				return err
+			}
+			_, err = db.ExecContext(ctx, ddl)
+			return errors.Wrap(err, "Can't create policy table")
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			ddl, err := a.DropTableSQL()
+			if err != nil {
+				return err
+			}
+			_, err = db.ExecContext(ctx, ddl)
+			return errors.Wrap(err, "Can't drop policy table")
+		},
+	}
+}
+
+// TriggerMigration returns bun migration which executes TriggerSQL() statements in transaction: Down() ones on down.
+// On up function is created via CREATE OR REPLACE and trigger is dropped (if exists) before creating, regardless of TriggerOptions.FunctionReplace
+// and TriggerOptions.TriggerReplace, so migration could be applied to database where PrepareTrigger() has installed them already
+func (a *BunAdapter) TriggerMigration(name string) migrate.Migration {
+	return migrate.Migration{
+		Name:    name,
+		Comment: triggerMigrationComment,
+		Up: func(ctx context.Context, db *bun.DB) error {
+			statements, err := a.triggerMigrationUp()
+			if err != nil {
+				return err
+			}
+			return execStatementsInTx(ctx, db, statements)
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			statements, err := a.TriggerSQL()
+			if err != nil {
+				return err
+			}
+			return execStatementsInTx(ctx, db, statements.Down())
+		},
+	}
+}
+
+// triggerMigrationUp returns statements of TriggerMigration() up which could be executed repeatedly
+func (a *BunAdapter) triggerMigrationUp() ([]string, error) {
+	err := a.requireDialect("TriggerMigration", dialect.PG)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := a.triggerStatements(true, false)
+	if err != nil {
+		return nil, err
+	}
+	return []string{statements.VersionTable, statements.Function, statements.FunctionComment, statements.DropTrigger, statements.Trigger}, nil
+}
+
+// RegisterMigrations adds TableMigration() and TriggerMigration() to migrations. Migrations are applied in order of names, so
+// tableName must be less than triggerName (e.g. "20240101000000" and "20240101000001"). Empty name means that migration is not needed
+func (a *BunAdapter) RegisterMigrations(migrations *migrate.Migrations, tableName, triggerName string) error {
+	if tableName != "" && triggerName != "" && tableName >= triggerName {
+		return errors.Errorf("Table migration '%s' must be applied before trigger migration '%s'", tableName, triggerName)
+	}
+	if tableName != "" {
+		migrations.Add(a.TableMigration(tableName))
+	}
+	if triggerName != "" {
+		_, err := a.TriggerSQL()
+		if err != nil {
+			return err
+		}
+		migrations.Add(a.TriggerMigration(triggerName))
+	}
+	return nil
+}
+
+func execStatementsInTx(ctx context.Context, db *bun.DB, statements []string) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, statement := range statements {
+			_, err := tx.ExecContext(ctx, statement)
+			if err != nil {
+				return errors.Wrapf(err, "Can't execute statement '%s'", statement)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/migrate"
+)
+
+// go test -run '^TestTriggerSQL$' *.go -v
+func TestTriggerSQL(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies"}))
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.VersionTable, `CREATE TABLE IF NOT EXISTS "public"."casbin_policy_version"`)
+	assert.Contains(t, statements.Function, `CREATE FUNCTION "public"."update_policies_table"()`)
+	assert.Contains(t, statements.Function, `'table', TG_TABLE_NAME`)
+	assert.Contains(t, statements.Trigger, "on\n  \"dev\".\"potato_policies\" for each row execute function")
+	assert.Equal(t, `DROP TRIGGER IF EXISTS "dev_potato_policies_casbin_trigger" ON "dev"."potato_policies";`, statements.DropTrigger)
+	assert.Equal(t, []string{statements.VersionTable, statements.Function, statements.FunctionComment, statements.Trigger}, statements.Up())
+	assert.Equal(t, []string{statements.DropTrigger, statements.DropFunction, statements.DropVersionTable}, statements.Down())
+
+	migrations := migrate.NewMigrations()
+	assert.Error(t, adapter.RegisterMigrations(migrations, "20240101000001", "20240101000000"))
+	assert.NoError(t, adapter.RegisterMigrations(migrations, "20240101000000", "20240101000001"))
+	sorted := migrations.Sorted()
+	assert.Len(t, sorted, 2)
+	assert.Equal(t, tableMigrationComment, sorted[0].Comment)
+	assert.Equal(t, triggerMigrationComment, sorted[1].Comment)
+
+	/* Migration replaces objects installed by PrepareTrigger() */
+	up, err := adapter.triggerMigrationUp()
+	assert.NoError(t, err)
+	if assert.Len(t, up, 5) {
+		assert.Contains(t, up[1], `CREATE OR REPLACE FUNCTION "public"."update_policies_table"()`)
+		assert.Equal(t, statements.FunctionComment, up[2])
+		assert.Equal(t, statements.DropTrigger, up[3])
+		assert.Equal(t, statements.Trigger, up[4])
+	}
+
+	_, err = newDialectAdapter(mssqlTestDialect{pgdialect.New()}).TriggerSQL()
+	assert.ErrorIs(t, err, ErrUnsupportedDialect)
+	report, err := newDialectAdapter(mssqlTestDialect{pgdialect.New()}).Uninstall(context.Background(), UninstallOptions{DryRun: true})
+	assert.ErrorIs(t, err, ErrUnsupportedDialect)
+	assert.Empty(t, report.Dropped)
+}
+
+// go test -run '^TestTableMigration$' *.go -v
+func TestTableMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	adapter := NewBunAdapter(db, WithMatcherOptions(MatcherOptions{TableName: "migrated_policies"}))
+	migrations := migrate.NewMigrations()
+	assert.NoError(t, adapter.RegisterMigrations(migrations, "20240101000000", ""))
+	migrator := migrate.NewMigrator(db, migrations)
+	assert.NoError(t, migrator.Init(ctx))
+
+	_, err := migrator.Migrate(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read"}))
+
+	_, err = migrator.Rollback(ctx)
+	assert.NoError(t, err)
+	assert.Error(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read"}))
+}
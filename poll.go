@@ -0,0 +1,235 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	defaultPollingOpts = PollingOptions{
+		Interval: time.Second,
+	}
+)
+
+// policyRevision is single-row table holding revision of the policy table. Revision is bumped by every write via BunAdapter
+type policyRevision struct {
+	bun.BaseModel `bun:"casbin_policy_revision,alias:r"`
+	ID            int   `bun:"id,pk"`
+	Revision      int64 `bun:"revision,notnull"`
+}
+
+// PollingOptions is for detecting changes by periodic reading of the policy table. Works with any database supported by bun
+type PollingOptions struct {
+	// How often policy table is checked
+	Interval time.Duration
+	// If policy table needed to be read only when revision table (see WithRevisionTable) has been changed.
+	// Otherwise the whole table is compared with the previous state every interval
+	UseRevisionTable bool
+}
+
+// pollingSource compares state of the policy table with the previous one and emits the difference as change events
+type pollingSource struct {
+	adapter      *BunAdapter
+	opts         PollingOptions
+	state        map[string]CasbinPolicy
+	lastRevision int64
+}
+
+// NewPollingSource returns change source which periodically reads the policy table. It does not require LISTEN/NOTIFY or triggers.
+// Events are emitted as DELETE and INSERT only (changed row is reported as removal of the old rule and adding of the new one).
+// If revision table is used then the last event of every detected change carries revision as its version
+func (a *BunAdapter) NewPollingSource(opts PollingOptions) ChangeSource {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultPollingOpts.Interval
+	}
+	return &pollingSource{
+		adapter: a,
+		opts:    opts,
+	}
+}
+
+// Run polls the policy table until ctx is done or error occurs. Initial state is read on start and it does not produce events
+func (src *pollingSource) Run(ctx context.Context, events chan<- TriggerDataPayload) error {
+	if src.opts.UseRevisionTable && src.adapter.revisionTable == "" {
+		return errors.New("Revision table is not enabled for the adapter. Use WithRevisionTable() option")
+	}
+	_, err := src.poll(ctx)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(src.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		changes, err := src.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, payload := range changes {
+			select {
+			case <-ctx.Done():
+				return nil
+			case events <- payload:
+			}
+		}
+	}
+}
+
+// poll reads the policy table and returns difference with the previous state
+func (src *pollingSource) poll(ctx context.Context) ([]TriggerDataPayload, error) {
+	var revision int64
+	var rows []CasbinPolicy
+	for {
+		if src.opts.UseRevisionTable {
+			var err error
+			revision, err = src.adapter.readRevision(ctx, src.adapter.DB)
+			if err != nil {
+				return nil, err
+			}
+			if src.state != nil && revision == src.lastRevision {
+				return nil, nil
+			}
+		}
+		var err error
+		rows, err = src.adapter.readPolicies(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Can't poll policy table")
+		}
+		if !src.opts.UseRevisionTable {
+			break
+		}
+		// Change committed between reading of revision and rows would be tagged with the old revision,
+		// so rows are read again until revision is the same before and after reading them
+		stable, err := src.adapter.readRevision(ctx, src.adapter.DB)
+		if err != nil {
+			return nil, err
+		}
+		if stable == revision {
+			break
+		}
+	}
+	state := policyState(rows)
+	var changes []TriggerDataPayload
+	if src.state != nil {
+		changes = diffPolicyStates(src.state, state)
+		if len(changes) > 0 {
+			changes[len(changes)-1].Version = revision
+		}
+	}
+	src.state = state
+	src.lastRevision = revision
+	return changes, nil
+}
+
+// diffPolicyStates returns removed rules followed by added ones. Both groups are sorted by rule
+func diffPolicyStates(prev, next map[string]CasbinPolicy) []TriggerDataPayload {
+	removed := []string{}
+	for key := range prev {
+		if _, ok := next[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	added := []string{}
+	for key := range next {
+		if _, ok := prev[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+	changes := make([]TriggerDataPayload, 0, len(removed)+len(added))
+	for _, key := range removed {
+		changes = append(changes, TriggerDataPayload{EventType: EVENT_PAYLOAD_DELETE, Old: prev[key]})
+	}
+	for _, key := range added {
+		changes = append(changes, TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: next[key]})
+	}
+	return changes
+}
+
+// policyState maps policies by their content. See diffPolicyStates()
+func policyState(policies []CasbinPolicy) map[string]CasbinPolicy {
+	state := make(map[string]CasbinPolicy, len(policies))
+	for _, policy := range policies {
+		state[policyKey(policy)] = policy
+	}
+	return state
+}
+
+// policyKey identifies policy by its content
+func policyKey(policy CasbinPolicy) string {
+	return strings.Join([]string{policy.PType, policy.V0, policy.V1, policy.V2, policy.V3, policy.V4, policy.V5}, "\x00")
+}
+
+// CreateRevisionTable creates revision table (see WithRevisionTable) if it does not exist and puts initial revision in it
+func (a *BunAdapter) CreateRevisionTable(ctx context.Context) error {
+	if a.revisionTable == "" {
+		return errors.New("Revision table is not enabled for the adapter. Use WithRevisionTable() option")
+	}
+	return a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewCreateTable().
+			Model((*policyRevision)(nil)).
+			ModelTableExpr("?", a.qualifiedTable(a.revisionTable)).
+			IfNotExists().
+			Exec(ctx)
+		if err != nil {
+			return errors.Wrap(err, "Can't create revision table")
+		}
+		exists, err := tx.NewSelect().
+			Model((*policyRevision)(nil)).
+			ModelTableExpr("? as r", a.qualifiedTable(a.revisionTable)).
+			Where("? = 1", bun.Ident("id")).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		_, err = tx.NewInsert().
+			Model(&policyRevision{ID: 1, Revision: 0}).
+			ModelTableExpr("?", a.qualifiedTable(a.revisionTable)).
+			Exec(ctx)
+		return err
+	})
+}
+
+// bumpRevision increments revision within the transaction and returns new value. Row lock keeps revisions in commit order
+func (a *BunAdapter) bumpRevision(ctx context.Context, tx bun.Tx) (int64, error) {
+	_, err := tx.NewUpdate().
+		Model((*policyRevision)(nil)).
+		ModelTableExpr("?", a.qualifiedTable(a.revisionTable)).
+		Set("? = ? + 1", bun.Ident("revision"), bun.Ident("revision")).
+		Where("? = 1", bun.Ident("id")).
+		Exec(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "Can't bump policy revision")
+	}
+	return a.readRevision(ctx, tx)
+}
+
+func (a *BunAdapter) readRevision(ctx context.Context, db bun.IDB) (int64, error) {
+	var revision int64
+	err := db.NewSelect().
+		Model((*policyRevision)(nil)).
+		ModelTableExpr("? as r", a.qualifiedTable(a.revisionTable)).
+		Column("revision").
+		Where("? = 1", bun.Ident("id")).
+		Scan(ctx, &revision)
+	if err != nil {
+		return 0, errors.Wrap(err, "Can't read policy revision")
+	}
+	return revision, nil
+}
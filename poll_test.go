@@ -0,0 +1,70 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestDiffPolicyStates$' *.go -v
+func TestDiffPolicyStates(t *testing.T) {
+	toState := func(policies ...CasbinPolicy) map[string]CasbinPolicy {
+		state := make(map[string]CasbinPolicy, len(policies))
+		for _, policy := range policies {
+			state[policyKey(policy)] = policy
+		}
+		return state
+	}
+	alice := NewCasbinPolicyFrom("p", []string{"alice", "data1", "read", "allow"})
+	bobAllow := NewCasbinPolicyFrom("p", []string{"bob", "data2", "write", "allow"})
+	bobDeny := NewCasbinPolicyFrom("p", []string{"bob", "data2", "write", "deny"})
+	admin := NewCasbinPolicyFrom("g", []string{"alice", "admin"})
+
+	changes := diffPolicyStates(toState(alice, bobAllow), toState(alice, bobDeny, admin))
+	assert.Equal(t, []TriggerDataPayload{
+		{EventType: EVENT_PAYLOAD_DELETE, Old: bobAllow},
+		{EventType: EVENT_PAYLOAD_INSERT, New: admin},
+		{EventType: EVENT_PAYLOAD_INSERT, New: bobDeny},
+	}, changes)
+
+	assert.Len(t, diffPolicyStates(toState(alice), toState(alice)), 0)
+}
+
+// go test -run '^TestPollingSourceRevision$' *.go -v
+func TestPollingSourceRevision(t *testing.T) {
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "polled_policies"}), WithRevisionTable("polled_policies_revision"))
+	ctx := context.Background()
+	assert.NoError(t, adapter.CreateRevisionTable(ctx))
+	src := adapter.NewPollingSource(PollingOptions{UseRevisionTable: true}).(*pollingSource)
+	changes, err := src.poll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 0)
+
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	assert.Equal(t, int64(1), adapter.LastWrittenVersion())
+	changes, err = src.poll(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, EVENT_PAYLOAD_INSERT, changes[0].EventType)
+		assert.Equal(t, int64(1), changes[0].Version)
+	}
+
+	/* Writes which change nothing do not bump revision */
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.RemovePolicy("p", "p", []string{"bob", "data1", "read", "allow"}))
+	_, err = CopyPolicies(ctx, adapter, NewBunAdapter(adapter.DB, WithMatcherOptions(MatcherOptions{TableName: "polled_policies"}), WithRevisionTable("polled_policies_revision")), CopyOptions{DryRun: true})
+	assert.NoError(t, err)
+	revision, err := adapter.readRevision(ctx, adapter.DB)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revision)
+	assert.Equal(t, int64(1), adapter.LastWrittenVersion())
+
+	assert.NoError(t, adapter.RemovePolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	changes, err = src.poll(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, EVENT_PAYLOAD_DELETE, changes[0].EventType)
+		assert.Equal(t, int64(2), changes[0].Version)
+	}
+}
@@ -0,0 +1,96 @@
+package casbinbunadapter
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestPolicyFromTuple$' *.go -v
+func TestPolicyFromTuple(t *testing.T) {
+	adapter := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{
+		SchemaName: "dev",
+		TableName:  "potato_policies",
+		PType:      "pt",
+		V1:         "haha",
+	}))
+	rel := &pglogrepl.RelationMessage{
+		Namespace:    "dev",
+		RelationName: "potato_policies",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id"}, {Name: "pt"}, {Name: "v0"}, {Name: "haha"}, {Name: "v2"}, {Name: "v3"}, {Name: "v4"}, {Name: "v5"},
+		},
+	}
+	text := func(s string) *pglogrepl.TupleDataColumn {
+		return &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeText, Data: []byte(s)}
+	}
+	null := &pglogrepl.TupleDataColumn{DataType: pglogrepl.TupleDataTypeNull}
+	tuple := &pglogrepl.TupleData{
+		Columns: []*pglogrepl.TupleDataColumn{text("5"), text("p"), text("alice"), text("data2"), text("write"), text("deny"), null, null},
+	}
+	policy, err := adapter.policyFromTuple(rel, tuple)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, policy.ID)
+	assert.Equal(t, "p", policy.PType)
+	assert.Equal(t, []string{"alice", "data2", "write", "deny"}, policy.getRuleDefinition())
+	assert.Nil(t, policy.CreatedAt)
+
+	/* Timestamps are sent same as by trigger */
+	stamped := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{CreatedAt: "created_at", UpdatedAt: "updated_at"}))
+	stampedRel := &pglogrepl.RelationMessage{
+		Columns: []*pglogrepl.RelationMessageColumn{{Name: "ptype"}, {Name: "v0"}, {Name: "created_at"}, {Name: "updated_at"}},
+	}
+	policy, err = stamped.policyFromTuple(stampedRel, &pglogrepl.TupleData{
+		Columns: []*pglogrepl.TupleDataColumn{text("p"), text("alice"), text("2024-05-01 10:00:00+00"), text("2024-05-02 12:30:00.5+03")},
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, policy.CreatedAt) && assert.NotNil(t, policy.UpdatedAt) {
+		assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), *policy.CreatedAt)
+		assert.Equal(t, time.Date(2024, 5, 2, 9, 30, 0, 500000000, time.UTC), *policy.UpdatedAt)
+	}
+
+	src := adapter.NewReplicationSource(ReplicationOptions{}).(*replicationSource)
+	assert.Equal(t, defaultReplicationOpts.SlotName, src.opts.SlotName)
+	src.relations = map[uint32]*pglogrepl.RelationMessage{1: rel, 2: {Namespace: "public", RelationName: "other"}}
+	_, ok := src.policyRelation(1)
+	assert.True(t, ok)
+	_, ok = src.policyRelation(2)
+	assert.False(t, ok)
+}
+
+// go test -run '^TestReplicationTruncate$' *.go -v
+func TestReplicationTruncate(t *testing.T) {
+	adapter := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies"}))
+	src := adapter.NewReplicationSource(ReplicationOptions{}).(*replicationSource)
+	src.relations = map[uint32]*pglogrepl.RelationMessage{
+		1: {RelationID: 1, Namespace: "dev", RelationName: "potato_policies"},
+		2: {RelationID: 2, Namespace: "public", RelationName: "other"},
+	}
+	truncate := func(relationIDs ...uint32) []byte {
+		data := []byte{byte(pglogrepl.MessageTypeTruncate)}
+		data = binary.BigEndian.AppendUint32(data, uint32(len(relationIDs)))
+		data = append(data, 0)
+		for _, relationID := range relationIDs {
+			data = binary.BigEndian.AppendUint32(data, relationID)
+		}
+		return data
+	}
+
+	/* TRUNCATE of the policy table along with other one */
+	payload, found, err := src.decode(truncate(2, 1))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, EVENT_PAYLOAD_RELOAD, payload.EventType)
+	assert.Equal(t, "dev", payload.Schema)
+	assert.Equal(t, "potato_policies", payload.Table)
+	_, owned := adapter.scopePayload(payload)
+	assert.True(t, owned)
+
+	/* TRUNCATE of other table */
+	_, found, err = src.decode(truncate(2))
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,230 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/migrate"
+)
+
+const (
+	defaultRLSSetting   = "app.tenant_id"
+	rlsMigrationComment = "casbin_policy_rls"
+)
+
+var (
+	rlsPolicyTemplate = `
+  CREATE POLICY %[1]s ON %[2]s
+  USING (%[3]s = current_setting(%[4]s, true))
+  WITH CHECK (%[3]s = current_setting(%[4]s, true));
+	`
+	enableRLSTemplate  = `ALTER TABLE %[1]s ENABLE ROW LEVEL SECURITY;`
+	forceRLSTemplate   = `ALTER TABLE %[1]s FORCE ROW LEVEL SECURITY;`
+	dropRLSTemplate    = `DROP POLICY IF EXISTS %[1]s ON %[2]s;`
+	noForceRLSTemplate = `ALTER TABLE %[1]s NO FORCE ROW LEVEL SECURITY;`
+	disableRLSTemplate = `ALTER TABLE %[1]s DISABLE ROW LEVEL SECURITY;`
+)
+
+// WithRLSSetting makes every adapter transaction to set session setting (local to the transaction) to tenant value (see WithTenant()),
+// so row-level security policies created via RLSSQL() could restrict rows by tenant. Reads are executed in transaction too.
+// Empty name means default one: "app.tenant_id". PostgreSQL only
+func WithRLSSetting(name string) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.rlsSetting = name
+		if a.rlsSetting == "" {
+			a.rlsSetting = defaultRLSSetting
+		}
+	}
+}
+
+// RLSStatements is SQL needed for row-level security of the policy table. See RLSSQL()
+type RLSStatements struct {
+	// Enables row-level security
+	Enable string
+	// Applies row-level security to the table owner too
+	Force string
+	// Creates policy comparing tenant column with session setting
+	Policy string
+	// Drops policy
+	DropPolicy string
+	// Stops applying row-level security to the table owner
+	NoForce string
+	// Disables row-level security
+	Disable string
+	// Statements for companion tables holding rules of tenants: history (see WithHistoryTable()) and snapshot (see WithSnapshotTable()) tables.
+	// Revision table (see WithRevisionTable()) holds single counter without rules, so it is not restricted
+	Companions []RLSStatements
+}
+
+// Up returns statements enabling row-level security in order of execution. Statements of companion tables follow the policy table ones
+func (rs RLSStatements) Up() []string {
+	statements := []string{rs.Enable, rs.Force, rs.Policy}
+	for _, companion := range rs.Companions {
+		statements = append(statements, companion.Up()...)
+	}
+	return statements
+}
+
+// Down returns statements disabling row-level security in order of execution. Statements of companion tables precede the policy table ones
+func (rs RLSStatements) Down() []string {
+	statements := []string{}
+	for _, companion := range rs.Companions {
+		statements = append(statements, companion.Down()...)
+	}
+	return append(statements, rs.DropPolicy, rs.NoForce, rs.Disable)
+}
+
+// RLSSQL returns statements restricting rows of the policy table by MatcherOptions.Tenant column: only rows of tenant stored in
+// session setting (see WithRLSSetting()) are visible and writable. Rows are hidden when setting is not set, so misconfigured adapter can't leak them.
+// Enabled history and snapshot tables are restricted the same way by their "tenant" column.
+// Attention: superusers and roles with BYPASSRLS attribute are not restricted
+func (a *BunAdapter) RLSSQL() (RLSStatements, error) {
+	err := a.requireDialect("RLSSQL", dialect.PG)
+	if err != nil {
+		return RLSStatements{}, err
+	}
+	err = a.Validate()
+	if err != nil {
+		return RLSStatements{}, err
+	}
+	if a.matcher.Tenant == "" {
+		return RLSStatements{}, errors.Wrap(ErrTenantNotSet, "Row-level security requires MatcherOptions.Tenant column")
+	}
+	statements, err := a.tableRLSStatements(a.matcher.TableName, a.matcher.Tenant)
+	if err != nil {
+		return RLSStatements{}, err
+	}
+	for _, companion := range []string{a.historyTable, a.snapshotTable} {
+		if companion == "" {
+			continue
+		}
+		companionStatements, err := a.tableRLSStatements(companion, "tenant")
+		if err != nil {
+			return RLSStatements{}, err
+		}
+		statements.Companions = append(statements.Companions, companionStatements)
+	}
+	return statements, nil
+}
+
+// tableRLSStatements returns statements restricting rows of the table located in MatcherOptions.SchemaName by tenant column
+func (a *BunAdapter) tableRLSStatements(tableName string, tenantColumn string) (RLSStatements, error) {
+	err := validatePgIdentifierLength("Row-level security policy name", rlsPolicyName(tableName))
+	if err != nil {
+		return RLSStatements{}, err
+	}
+	table := pgQuoteQualified(a.matcher.SchemaName, tableName)
+	policyName := pgQuoteIdent(rlsPolicyName(tableName))
+	return RLSStatements{
+		Enable:     fmt.Sprintf(enableRLSTemplate, table),
+		Force:      fmt.Sprintf(forceRLSTemplate, table),
+		Policy:     fmt.Sprintf(rlsPolicyTemplate, policyName, table, pgQuoteIdent(tenantColumn), pgQuoteLiteral(a.rlsSettingName())),
+		DropPolicy: fmt.Sprintf(dropRLSTemplate, policyName, table),
+		NoForce:    fmt.Sprintf(noForceRLSTemplate, table),
+		Disable:    fmt.Sprintf(disableRLSTemplate, table),
+	}, nil
+}
+
+// RLSMigration returns bun migration which executes RLSSQL() statements in transaction: Up() ones on up and Down() ones on down
+func (a *BunAdapter) RLSMigration(name string) migrate.Migration {
+	return migrate.Migration{
+		Name:    name,
+		Comment: rlsMigrationComment,
+		Up: func(ctx context.Context, db *bun.DB) error {
+			statements, err := a.RLSSQL()
+			if err != nil {
+				return err
+			}
+			return execStatementsInTx(ctx, db, statements.Up())
+		},
+		Down: func(ctx context.Context, db *bun.DB) error {
+			statements, err := a.RLSSQL()
+			if err != nil {
+				return err
+			}
+			return execStatementsInTx(ctx, db, statements.Down())
+		},
+	}
+}
+
+// rlsPolicyName returns name of row-level security policy of the table: "$TABLE_NAME$_tenant_isolation"
+func rlsPolicyName(tableName string) string {
+	return tableName + "_tenant_isolation"
+}
+
+// rlsSettingName returns name of session setting holding tenant
+func (a *BunAdapter) rlsSettingName() string {
+	if a.rlsSetting == "" {
+		return defaultRLSSetting
+	}
+	return a.rlsSetting
+}
+
+// validateRLSSetting checks that session setting could be used: PostgreSQL accepts custom settings with prefix only (e.g. "app.tenant_id")
+func (a *BunAdapter) validateRLSSetting() error {
+	if a.rlsSetting == "" {
+		return nil
+	}
+	if a.matcher.Tenant == "" {
+		return errors.Wrap(ErrTenantNotSet, "WithRLSSetting() requires MatcherOptions.Tenant column")
+	}
+	dot := strings.IndexByte(a.rlsSetting, '.')
+	if dot <= 0 || dot == len(a.rlsSetting)-1 {
+		return errors.Wrapf(ErrInvalidIdentifier, "Session setting '%s' must be prefixed, e.g. '%s'", a.rlsSetting, defaultRLSSetting)
+	}
+	return validateIdentifier("Session setting", a.rlsSetting)
+}
+
+// runTx executes fn in transaction. Tenant is passed to row-level security policies via session setting (see WithRLSSetting()),
+// change metadata is passed to the trigger function (see WithChangeMetadata())
+func (a *BunAdapter) runTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error {
+	return a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := a.setTenantSetting(ctx, tx)
+		if err != nil {
+			return err
+		}
+		err = a.setMetadataSettings(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, tx)
+	})
+}
+
+// setTenantSetting sets row-level security session setting (local to the transaction) to tenant of the adapter. See WithRLSSetting()
+func (a *BunAdapter) setTenantSetting(ctx context.Context, tx bun.Tx) error {
+	if a.rlsSetting == "" || a.dialectName() != dialect.PG {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "SELECT set_config(?, ?, true)", a.rlsSetting, a.tenant)
+	if err != nil {
+		return errors.Wrap(err, "Can't set tenant session setting")
+	}
+	return nil
+}
+
+// readPolicies reads policies of the table which are valid now (see MatcherOptions.ValidFrom and MatcherOptions.ValidTo)
+func (a *BunAdapter) readPolicies(ctx context.Context) ([]CasbinPolicy, error) {
+	var data []CasbinPolicy
+	err := a.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		var err error
+		data, err = a.selectPoliciesWhere(ctx, db, a.scopeValidity(time.Now().UTC()))
+		return err
+	})
+	return data, err
+}
+
+// runRead runs reading queries. Transaction is used when row-level security session setting is enabled
+func (a *BunAdapter) runRead(ctx context.Context, fn func(ctx context.Context, db bun.IDB) error) error {
+	if a.rlsSetting == "" {
+		return fn(ctx, a.DB)
+	}
+	return a.runTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return fn(ctx, tx)
+	})
+}
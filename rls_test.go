@@ -0,0 +1,103 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestRLSSQL$' *.go -v
+func TestRLSSQL(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(),
+		WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies", Tenant: "tenant_id"}),
+		WithTenant("acme"),
+		WithRLSSetting(""),
+	)
+	assert.Equal(t, "app.tenant_id", adapter.rlsSettingName())
+	statements, err := adapter.RLSSQL()
+	assert.NoError(t, err)
+	assert.Equal(t, `ALTER TABLE "dev"."potato_policies" ENABLE ROW LEVEL SECURITY;`, statements.Enable)
+	assert.Equal(t, `ALTER TABLE "dev"."potato_policies" FORCE ROW LEVEL SECURITY;`, statements.Force)
+	assert.Contains(t, statements.Policy, `CREATE POLICY "potato_policies_tenant_isolation" ON "dev"."potato_policies"`)
+	assert.Contains(t, statements.Policy, `USING ("tenant_id" = current_setting('app.tenant_id', true))`)
+	assert.Contains(t, statements.Policy, `WITH CHECK ("tenant_id" = current_setting('app.tenant_id', true))`)
+	assert.Equal(t, []string{statements.DropPolicy, statements.NoForce, statements.Disable}, statements.Down())
+	assert.Empty(t, statements.Companions)
+
+	/* Companion tables holding rules are restricted too */
+	adapter = newDialectAdapter(pgdialect.New(),
+		WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies", Tenant: "tenant_id"}),
+		WithTenant("acme"),
+		WithRLSSetting(""),
+		WithHistoryTable(""),
+		WithSnapshotTable(""),
+		WithRevisionTable(""),
+	)
+	statements, err = adapter.RLSSQL()
+	assert.NoError(t, err)
+	if assert.Len(t, statements.Companions, 2) {
+		history, snapshot := statements.Companions[0], statements.Companions[1]
+		assert.Equal(t, `ALTER TABLE "dev"."casbin_policy_history" ENABLE ROW LEVEL SECURITY;`, history.Enable)
+		assert.Contains(t, history.Policy, `CREATE POLICY "casbin_policy_history_tenant_isolation" ON "dev"."casbin_policy_history"`)
+		assert.Contains(t, history.Policy, `USING ("tenant" = current_setting('app.tenant_id', true))`)
+		assert.Contains(t, snapshot.Policy, `CREATE POLICY "casbin_policy_snapshot_tenant_isolation" ON "dev"."casbin_policy_snapshot"`)
+		assert.Len(t, statements.Up(), 9)
+		assert.Equal(t, statements.Policy, statements.Up()[2])
+		down := statements.Down()
+		assert.Equal(t, history.DropPolicy, down[0])
+		assert.Equal(t, statements.Disable, down[len(down)-1])
+	}
+
+	/* Tenant column is required */
+	adapter = newDialectAdapter(pgdialect.New())
+	_, err = adapter.RLSSQL()
+	assert.ErrorIs(t, err, ErrTenantNotSet)
+	adapter = newDialectAdapter(pgdialect.New(), WithRLSSetting(""))
+	assert.ErrorIs(t, adapter.Validate(), ErrTenantNotSet)
+
+	/* Custom settings must be prefixed */
+	adapter = newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{Tenant: "tenant_id"}), WithTenant("acme"), WithRLSSetting("tenant_id"))
+	assert.ErrorIs(t, adapter.Validate(), ErrInvalidIdentifier)
+
+	/* Other dialects */
+	adapter = newSQLiteAdapter(t)
+	_, err = adapter.RLSSQL()
+	assert.ErrorIs(t, err, ErrUnsupportedDialect)
+}
+
+// go test -run '^TestRLSListPolicies$' *.go -v
+func TestRLSListPolicies(t *testing.T) {
+	connector := &recordingConnector{}
+	adapter := newRecordingAdapter(pgdialect.New(), connector,
+		WithMatcherOptions(MatcherOptions{TableName: "potato_policies", Tenant: "tenant_id"}),
+		WithTenant("acme"),
+		WithRLSSetting(""),
+	)
+	_, err := adapter.ListPolicies(context.Background(), ListFilter{})
+	assert.NoError(t, err)
+	statements := connector.Statements()
+	selected := indexOfStatement(statements, `FROM "public"."potato_policies"`)
+	if assert.Greater(t, selected, 0) {
+		assert.Equal(t, "SELECT set_config('app.tenant_id', 'acme', true)", statements[selected-1])
+	}
+}
+
+// go test -run '^TestRLSQueryHistory$' *.go -v
+func TestRLSQueryHistory(t *testing.T) {
+	connector := &recordingConnector{}
+	adapter := newRecordingAdapter(pgdialect.New(), connector,
+		WithMatcherOptions(MatcherOptions{TableName: "potato_policies", Tenant: "tenant_id"}),
+		WithTenant("acme"),
+		WithRLSSetting(""),
+		WithHistoryTable(""),
+	)
+	_, err := adapter.QueryHistory(context.Background(), HistoryFilter{Subject: "alice"})
+	assert.NoError(t, err)
+	statements := connector.Statements()
+	selected := indexOfStatement(statements, `FROM "public"."casbin_policy_history" as h`)
+	if assert.Greater(t, selected, 0) {
+		assert.Equal(t, "SELECT set_config('app.tenant_id', 'acme', true)", statements[selected-1])
+	}
+}
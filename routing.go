@@ -0,0 +1,191 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun/dialect"
+)
+
+// SchemaResolver picks schema and table of the policy table for the call (e.g. from tenant stored in context).
+// Empty values mean MatcherOptions.SchemaName and MatcherOptions.TableName
+type SchemaResolver func(ctx context.Context) (schemaName string, tableName string, err error)
+
+// routingKey identifies resolved table. Names are kept apart since they could contain dots
+type routingKey struct {
+	schema string
+	table  string
+}
+
+// String returns "$SCHEMA_NAME$.$TABLE_NAME$"
+func (key routingKey) String() string {
+	return key.schema + "." + key.table
+}
+
+// schemaRouting is state of WithSchemaResolver()
+type schemaRouting struct {
+	resolve   SchemaResolver
+	provision bool
+	mu        sync.Mutex
+	// Adapters bound to resolved tables
+	targets map[routingKey]*BunAdapter
+	// Tables being bound (and provisioned). Channel is closed when binding is done, so lock is not held during DDL
+	pending map[routingKey]chan struct{}
+}
+
+func newSchemaRouting() *schemaRouting {
+	return &schemaRouting{targets: map[routingKey]*BunAdapter{}, pending: map[routingKey]chan struct{}{}}
+}
+
+// WithSchemaResolver makes every *Ctx method (see persist.ContextAdapter) to work with table picked by resolver instead of fixed
+// MatcherOptions.SchemaName and MatcherOptions.TableName. Methods without context use context.Background()
+func WithSchemaResolver(resolver SchemaResolver) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		if a.routing == nil {
+			a.routing = newSchemaRouting()
+		}
+		a.routing.resolve = resolver
+	}
+}
+
+// WithProvisioning makes adapter to create schema (PostgreSQL only), policy table, enabled history, snapshot and revision tables
+// and trigger (PostgreSQL only) on first use of table picked by resolver. See WithSchemaResolver()
+func WithProvisioning() func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		if a.routing == nil {
+			a.routing = newSchemaRouting()
+		}
+		a.routing.provision = true
+	}
+}
+
+// ForContext returns adapter bound to table picked by resolver for the context. Adapter itself is returned when there is no resolver.
+// Returned adapter could be used for any method (e.g. PrepareTrigger() or StartUpdatesListening())
+func (a *BunAdapter) ForContext(ctx context.Context) (*BunAdapter, error) {
+	return a.resolveTarget(ctx)
+}
+
+// resolveTarget returns adapter bound to table picked by resolver. Table is provisioned once when WithProvisioning() is used
+func (a *BunAdapter) resolveTarget(ctx context.Context) (*BunAdapter, error) {
+	err := a.checkOptions()
+	if err != nil {
+		return nil, err
+	}
+	if a.routing == nil || a.routing.resolve == nil {
+		return a, nil
+	}
+	var schemaName, tableName string
+	schemaName, tableName, err = a.routing.resolve(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't resolve policy table")
+	}
+	if schemaName == "" {
+		schemaName = a.matcher.SchemaName
+	}
+	if tableName == "" {
+		tableName = a.matcher.TableName
+	}
+	key := routingKey{schema: schemaName, table: tableName}
+	for {
+		a.routing.mu.Lock()
+		if target, ok := a.routing.targets[key]; ok {
+			a.routing.mu.Unlock()
+			return target, nil
+		}
+		done, busy := a.routing.pending[key]
+		if !busy {
+			a.routing.pending[key] = make(chan struct{})
+			a.routing.mu.Unlock()
+			break
+		}
+		a.routing.mu.Unlock()
+		// Failed binding is retried by one of waiting calls
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "Can't wait for policy table '%s'", key)
+		}
+	}
+	target, err := a.bindTarget(ctx, key)
+	a.routing.mu.Lock()
+	if err == nil {
+		a.routing.targets[key] = target
+	}
+	close(a.routing.pending[key])
+	delete(a.routing.pending, key)
+	a.routing.mu.Unlock()
+	return target, err
+}
+
+// bindTarget returns adapter bound to the table. Table is provisioned when WithProvisioning() is used
+func (a *BunAdapter) bindTarget(ctx context.Context, key routingKey) (*BunAdapter, error) {
+	target := &BunAdapter{}
+	*target = *a
+	target.matcher.SchemaName = key.schema
+	target.matcher.TableName = key.table
+	// Bound adapter must not be routed again
+	target.routing = nil
+	err := target.Validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid resolved policy table '%s'", key)
+	}
+	if a.routing.provision {
+		// Failed provisioning is retried by the next call
+		err = target.provision(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Can't provision policy table '%s'", key)
+		}
+	}
+	return target, nil
+}
+
+// forgetTarget drops adapter bound to the table, so the next call binds (and provisions) it again
+func (a *BunAdapter) forgetTarget(key routingKey) {
+	if a.routing == nil {
+		return
+	}
+	a.routing.mu.Lock()
+	defer a.routing.mu.Unlock()
+	delete(a.routing.targets, key)
+}
+
+// provision creates schema, policy table, enabled companion tables (history, snapshot and revision ones) and trigger if they do not exist
+func (a *BunAdapter) provision(ctx context.Context) error {
+	if a.dialectName() == dialect.PG {
+		query, err := a.formatSQL("CREATE SCHEMA IF NOT EXISTS ?", qualifiedName{name: a.matcher.SchemaName})
+		if err != nil {
+			return err
+		}
+		_, err = a.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+	}
+	err := a.CreateTable(ctx)
+	if err != nil {
+		return err
+	}
+	if a.historyTable != "" {
+		err = a.CreateHistoryTable(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if a.snapshotTable != "" {
+		err = a.CreateSnapshotTable(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if a.revisionTable != "" {
+		err = a.CreateRevisionTable(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if a.dialectName() != dialect.PG {
+		return nil
+	}
+	return a.PrepareTriggerCtx(ctx)
+}
@@ -0,0 +1,185 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type testTenantKey struct{}
+
+// go test -run '^TestSchemaResolver$' *.go -v
+func TestSchemaResolver(t *testing.T) {
+	db := newSQLiteDB(t)
+	// SQLite has no schemas, so tenants are routed to tables
+	resolver := func(ctx context.Context) (string, string, error) {
+		tenant, _ := ctx.Value(testTenantKey{}).(string)
+		if tenant == "" {
+			return "", "", nil
+		}
+		return "", "routed_" + tenant, nil
+	}
+	adapter := NewBunAdapter(db, WithSchemaResolver(resolver), WithProvisioning())
+	var _ persist.ContextAdapter = adapter
+	ctxA := context.WithValue(context.Background(), testTenantKey{}, "a")
+	ctxB := context.WithValue(context.Background(), testTenantKey{}, "b")
+
+	assert.NoError(t, adapter.AddPolicyCtx(ctxA, "p", "p", []string{"alice", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.AddPolicyCtx(ctxB, "p", "p", []string{"bob", "data2", "write", "allow"}))
+	assert.NoError(t, adapter.AddPolicyCtx(ctxB, "p", "p", []string{"bob", "data3", "write", "allow"}))
+
+	targetA, err := adapter.ForContext(ctxA)
+	assert.NoError(t, err)
+	assert.Equal(t, "routed_a", targetA.matcher.TableName)
+	rows, err := targetA.selectPolicies(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	targetB, err := adapter.ForContext(ctxB)
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.RemoveFilteredPolicyCtx(ctxB, "p", "p", 1, "data2"))
+	rows, err = targetB.selectPolicies(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+
+	/* Enforcers are kept per table */
+	evicted := []string{}
+	manager := NewEnforcerManager(adapter, testRBACModel, 1, WithEvictionHook(func(key string, _ *casbin.SyncedEnforcer) {
+		evicted = append(evicted, key)
+	}))
+	enforcerA, err := manager.Enforcer(ctxA)
+	assert.NoError(t, err)
+	allowed, err := enforcerA.Enforce("alice", "data1", "read")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	again, err := manager.Enforcer(ctxA)
+	assert.NoError(t, err)
+	assert.Same(t, enforcerA, again)
+
+	enforcerB, err := manager.Enforcer(ctxB)
+	assert.NoError(t, err)
+	allowed, err = enforcerB.Enforce("alice", "data1", "read")
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 1, manager.Len())
+	assert.Equal(t, []string{"public.routed_a"}, evicted)
+	// Adapter bound to evicted table is dropped too
+	assert.Len(t, adapter.routing.targets, 1)
+
+	/* Concurrent calls share single enforcer */
+	var wg sync.WaitGroup
+	loaded := make([]*casbin.SyncedEnforcer, 8)
+	for i := range loaded {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			enforcer, err := manager.Enforcer(ctxA)
+			assert.NoError(t, err)
+			loaded[i] = enforcer
+		}(i)
+	}
+	wg.Wait()
+	for _, enforcer := range loaded {
+		assert.Same(t, loaded[0], enforcer)
+	}
+
+	/* Invalid names are rejected */
+	bad := NewBunAdapter(db, WithSchemaResolver(func(ctx context.Context) (string, string, error) {
+		return "", "bad\x00table", nil
+	}))
+	assert.ErrorIs(t, bad.AddPolicyCtx(context.Background(), "p", "p", []string{"alice"}), ErrInvalidIdentifier)
+}
+
+// go test -run '^TestRoutedSubscriptions$' *.go -v
+func TestRoutedSubscriptions(t *testing.T) {
+	// Triggers of every schema call the same function, so both schemas share the channel
+	adapter := newDialectAdapter(pgdialect.New(), WithSchemaResolver(func(ctx context.Context) (string, string, error) {
+		tenant, _ := ctx.Value(testTenantKey{}).(string)
+		return "tenant_" + tenant, "", nil
+	}))
+	hub, listeners := newTestHub()
+	defer hub.Close()
+	enforcers := map[string]*casbin.SyncedEnforcer{}
+	targets := map[string]*BunAdapter{}
+	for _, tenant := range []string{"a", "b"} {
+		target, err := adapter.ForContext(context.WithValue(context.Background(), testTenantKey{}, tenant))
+		assert.NoError(t, err)
+		enforcers[tenant] = newTestEnforcer(t)
+		targets[tenant] = target
+		_, err = target.SubscribeEnforcer(context.Background(), hub, enforcers[tenant])
+		assert.NoError(t, err)
+	}
+	assert.Len(t, listeners, 1)
+
+	payloadA := insertPayload(1, "p", "alice", "data1", "read", "allow")
+	payloadA.Schema, payloadA.Table = "tenant_a", "casbin_policy"
+	payloadB := insertPayload(2, "p", "bob", "data2", "write", "allow")
+	payloadB.Schema, payloadB.Table = "tenant_b", "casbin_policy"
+	listeners[adapter.trigger.ChannelName].notify(payloadA)
+	listeners[adapter.trigger.ChannelName].notify(payloadB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, targets["a"].WaitForVersion(ctx, 1))
+	assert.NoError(t, targets["b"].WaitForVersion(ctx, 2))
+	policies, err := enforcers["a"].GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"alice", "data1", "read", "allow"}}, policies)
+	policies, err = enforcers["b"].GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "data2", "write", "allow"}}, policies)
+}
+
+// go test -run '^TestRoutingKeys$' *.go -v
+func TestRoutingKeys(t *testing.T) {
+	tables := map[string][2]string{"first": {"a.b", "c"}, "second": {"a", "b.c"}}
+	adapter := newDialectAdapter(pgdialect.New(), WithSchemaResolver(func(ctx context.Context) (string, string, error) {
+		tenant, _ := ctx.Value(testTenantKey{}).(string)
+		return tables[tenant][0], tables[tenant][1], nil
+	}))
+	first, err := adapter.ForContext(context.WithValue(context.Background(), testTenantKey{}, "first"))
+	assert.NoError(t, err)
+	second, err := adapter.ForContext(context.WithValue(context.Background(), testTenantKey{}, "second"))
+	assert.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.Equal(t, "b.c", second.matcher.TableName)
+	assert.Len(t, adapter.routing.targets, 2)
+}
+
+// go test -run '^TestRoutedCompanionTables$' *.go -v
+func TestRoutedCompanionTables(t *testing.T) {
+	// Nothing exists yet
+	connector := &recordingConnector{rows: func(query string) [][]driver.Value {
+		switch {
+		case strings.Contains(query, "obj_description"):
+			return [][]driver.Value{{false, nil}}
+		case strings.Contains(query, "pg_trigger"), strings.Contains(query, "to_regclass"):
+			return [][]driver.Value{{false}}
+		}
+		return nil
+	}}
+	adapter := newRecordingAdapter(pgdialect.New(), connector,
+		WithSchemaResolver(func(ctx context.Context) (string, string, error) {
+			tenant, _ := ctx.Value(testTenantKey{}).(string)
+			return "tenant_" + tenant, "", nil
+		}),
+		WithProvisioning(),
+		WithHistoryTable(""),
+		WithSnapshotTable(""),
+	)
+	ctx := context.WithValue(context.Background(), testTenantKey{}, "a")
+	_, err := adapter.QueryHistory(ctx, HistoryFilter{})
+	assert.NoError(t, err)
+	statements := connector.Statements()
+	for _, table := range []string{`"tenant_a"."casbin_policy"`, `"tenant_a"."casbin_policy_history"`, `"tenant_a"."casbin_policy_snapshot"`} {
+		assert.GreaterOrEqual(t, indexOfStatement(statements, "CREATE TABLE IF NOT EXISTS "+table), 0, table)
+	}
+	assert.Contains(t, statements[len(statements)-1], `FROM "tenant_a"."casbin_policy_history" as h`)
+}
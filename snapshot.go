@@ -0,0 +1,373 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	defaultSnapshotTable = "casbin_policy_snapshot"
+)
+
+var (
+	// ErrSnapshotNotFound is returned when there is no snapshot with given name
+	ErrSnapshotNotFound = errors.New("Snapshot not found")
+	// ErrSnapshotExists is returned by CreateSnapshot() when snapshot with given name exists already
+	ErrSnapshotExists = errors.New("Snapshot exists already")
+)
+
+// WithSnapshotTable enables named snapshots of the policy stored in the table located in MatcherOptions.SchemaName.
+// Empty name means default one: "casbin_policy_snapshot". Table must be created via CreateSnapshotTable()
+func WithSnapshotTable(tableName string) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.snapshotTable = tableName
+		if a.snapshotTable == "" {
+			a.snapshotTable = defaultSnapshotTable
+		}
+	}
+}
+
+// policySnapshotRow is row of the snapshot table. Rules are stored as JSON array of [ptype, v0, ..., v5] arrays.
+// Name is unique per tenant. Tenant is empty string (not NULL) when MatcherOptions.Tenant is not set, so unique constraint covers such rows too
+type policySnapshotRow struct {
+	bun.BaseModel `bun:"casbin_policy_snapshot,alias:s"`
+	ID            int64     `bun:"id,pk,autoincrement"`
+	Name          string    `bun:"name,type:varchar(256),notnull"`
+	Tenant        string    `bun:"tenant,type:varchar(256),notnull,default:''"`
+	RuleCount     int       `bun:"rule_count,notnull"`
+	Rules         string    `bun:"rules,type:text,notnull"`
+	CreatedAt     time.Time `bun:"created_at,notnull"`
+	Actor         string    `bun:"actor,type:varchar(256),nullzero"`
+	Reason        string    `bun:"reason,type:text,nullzero"`
+}
+
+// Snapshot describes named copy of the policy. See CreateSnapshot()
+type Snapshot struct {
+	ID   int64
+	Name string
+	// Tenant of the snapshot. Empty if MatcherOptions.Tenant is not set
+	Tenant string
+	// Number of rules in the snapshot
+	RuleCount int
+	CreatedAt time.Time
+	// Metadata of the context (see WithChangeMetadata()) used for creating the snapshot
+	Actor  string
+	Reason string
+}
+
+// SnapshotDiff is difference between snapshot and current policy. See DiffSnapshot()
+type SnapshotDiff struct {
+	// Rules which have been added after the snapshot. RestoreSnapshot() removes them
+	Added []CasbinPolicy
+	// Rules which have been removed after the snapshot. RestoreSnapshot() brings them back
+	Removed []CasbinPolicy
+}
+
+// Empty returns true if policy has not been changed since the snapshot
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+func (row policySnapshotRow) toSnapshot() Snapshot {
+	return Snapshot{
+		ID:        row.ID,
+		Name:      row.Name,
+		Tenant:    row.Tenant,
+		RuleCount: row.RuleCount,
+		CreatedAt: row.CreatedAt,
+		Actor:     row.Actor,
+		Reason:    row.Reason,
+	}
+}
+
+// policies decodes rules of the snapshot
+func (row policySnapshotRow) policies() ([]CasbinPolicy, error) {
+	var rules [][]string
+	err := json.Unmarshal([]byte(row.Rules), &rules)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Can't decode rules of snapshot '%s'", row.Name)
+	}
+	policies := make([]CasbinPolicy, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule) == 0 {
+			continue
+		}
+		policies = append(policies, NewCasbinPolicyFrom(rule[0], rule[1:]))
+	}
+	return policies, nil
+}
+
+// encodeSnapshotRules encodes policies as JSON array of [ptype, v0, ..., v5] arrays. Empty values are kept, so rules are restored exactly
+func encodeSnapshotRules(policies []CasbinPolicy) (string, error) {
+	rules := make([][]string, 0, len(policies))
+	for _, policy := range policies {
+		rules = append(rules, []string{policy.PType, policy.V0, policy.V1, policy.V2, policy.V3, policy.V4, policy.V5})
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// requireSnapshotTable returns error if snapshots are not enabled
+func (a *BunAdapter) requireSnapshotTable() error {
+	if a.snapshotTable == "" {
+		return errors.New("Snapshot table is not enabled for the adapter. Use WithSnapshotTable() option")
+	}
+	return nil
+}
+
+// CreateSnapshotTable creates snapshot table (see WithSnapshotTable) if it does not exist
+func (a *BunAdapter) CreateSnapshotTable(ctx context.Context) error {
+	err := a.requireSnapshotTable()
+	if err != nil {
+		return err
+	}
+	_, err = a.NewCreateTable().
+		Model((*policySnapshotRow)(nil)).
+		ModelTableExpr("?", a.qualifiedTable(a.snapshotTable)).
+		ColumnExpr("CONSTRAINT ? UNIQUE (?, ?)", bun.Name(a.snapshotTable+"_unique"), bun.Ident("tenant"), bun.Ident("name")).
+		IfNotExists().
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Can't create snapshot table")
+	}
+	return nil
+}
+
+// scopeSnapshots restricts query of the snapshot table by current tenant
+func (a *BunAdapter) scopeSnapshots(query bun.QueryBuilder) bun.QueryBuilder {
+	if a.matcher.Tenant == "" {
+		return query
+	}
+	return query.Where("? = ?", bun.Ident("tenant"), a.tenant)
+}
+
+// selectSnapshot reads snapshot by name. ErrSnapshotNotFound is returned if there is no such snapshot
+func (a *BunAdapter) selectSnapshot(ctx context.Context, db bun.IDB, name string) (policySnapshotRow, error) {
+	row := policySnapshotRow{}
+	err := db.NewSelect().
+		Model(&row).
+		ModelTableExpr("? as s", a.qualifiedTable(a.snapshotTable)).
+		Where("? = ?", bun.Ident("name"), name).
+		ApplyQueryBuilder(a.scopeSnapshots).
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return row, errors.Wrapf(ErrSnapshotNotFound, "Snapshot '%s'", name)
+	}
+	return row, err
+}
+
+// CreateSnapshot stores rules which are loaded by LoadPolicy() now (of current tenant if MatcherOptions.Tenant is set) under the name.
+// Validity windows (see MatcherOptions.ValidFrom) are not stored. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) CreateSnapshot(ctx context.Context, name string) (Snapshot, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	err = a.requireSnapshotTable()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if name == "" {
+		return Snapshot{}, errors.New("Snapshot name is empty")
+	}
+	var row policySnapshotRow
+	err = a.runTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		_, err := a.selectSnapshot(ctx, tx, name)
+		switch {
+		case err == nil:
+			return errors.Wrapf(ErrSnapshotExists, "Snapshot '%s'", name)
+		case !errors.Is(err, ErrSnapshotNotFound):
+			return err
+		}
+		now := time.Now().UTC()
+		policies, err := a.selectPoliciesWhere(ctx, tx, a.scopeValidity(now))
+		if err != nil {
+			return err
+		}
+		rules, err := encodeSnapshotRules(policies)
+		if err != nil {
+			return err
+		}
+		metadata := a.changeMetadata(ctx)
+		row = policySnapshotRow{
+			Name:      name,
+			Tenant:    a.tenant,
+			RuleCount: len(policies),
+			Rules:     rules,
+			CreatedAt: now,
+			Actor:     metadata.Actor,
+			Reason:    metadata.Reason,
+		}
+		query := tx.NewInsert().
+			Model(&row).
+			ModelTableExpr("?", a.qualifiedTable(a.snapshotTable))
+		if a.dialectName() != dialect.MSSQL {
+			// Snapshot created concurrently is caught by unique constraint. SQL Server reports violation as error, see isMSSQLUniqueViolation()
+			query = query.Ignore()
+		}
+		res, err := query.Exec(ctx)
+		if isMSSQLUniqueViolation(err) {
+			return errors.Wrapf(ErrSnapshotExists, "Snapshot '%s'", name)
+		}
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return errors.Wrapf(ErrSnapshotExists, "Snapshot '%s'", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return Snapshot{}, errors.Wrapf(err, "Can't create snapshot '%s'", name)
+	}
+	return row.toSnapshot(), nil
+}
+
+// ListSnapshots returns snapshots (of current tenant if MatcherOptions.Tenant is set) in order of creation
+func (a *BunAdapter) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = a.requireSnapshotTable()
+	if err != nil {
+		return nil, err
+	}
+	var rows []policySnapshotRow
+	err = a.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		return db.NewSelect().
+			Model(&rows).
+			ModelTableExpr("? as s", a.qualifiedTable(a.snapshotTable)).
+			ExcludeColumn("rules").
+			ApplyQueryBuilder(a.scopeSnapshots).
+			OrderExpr("? ASC", bun.Ident("id")).
+			Scan(ctx)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't list snapshots")
+	}
+	snapshots := make([]Snapshot, 0, len(rows))
+	for _, row := range rows {
+		snapshots = append(snapshots, row.toSnapshot())
+	}
+	return snapshots, nil
+}
+
+// DiffSnapshot compares the snapshot with rules which are loaded by LoadPolicy() now
+func (a *BunAdapter) DiffSnapshot(ctx context.Context, name string) (SnapshotDiff, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return SnapshotDiff{}, err
+	}
+	err = a.requireSnapshotTable()
+	if err != nil {
+		return SnapshotDiff{}, err
+	}
+	var snapshot, current []CasbinPolicy
+	err = a.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		row, err := a.selectSnapshot(ctx, db, name)
+		if err != nil {
+			return err
+		}
+		snapshot, err = row.policies()
+		if err != nil {
+			return err
+		}
+		current, err = a.selectPoliciesWhere(ctx, db, a.scopeValidity(time.Now().UTC()))
+		return err
+	})
+	if err != nil {
+		return SnapshotDiff{}, errors.Wrapf(err, "Can't compare snapshot '%s'", name)
+	}
+	diff := SnapshotDiff{}
+	for _, change := range diffPolicyStates(policyState(snapshot), policyState(current)) {
+		switch change.EventType {
+		case EVENT_PAYLOAD_INSERT:
+			diff.Added = append(diff.Added, change.New)
+		case EVENT_PAYLOAD_DELETE:
+			diff.Removed = append(diff.Removed, change.Old)
+		}
+	}
+	return diff, nil
+}
+
+// RestoreSnapshot makes rules equal to the snapshot within single transaction. Only changed rows are written (see DiffSnapshot()),
+// so they are recorded in history table as usual. Listeners of PostgreSQL channel receive RELOAD event after the changes.
+// Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) RestoreSnapshot(ctx context.Context, name string) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	err = a.requireSnapshotTable()
+	if err != nil {
+		return err
+	}
+	err = a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		row, err := a.selectSnapshot(ctx, tx, name)
+		if err != nil {
+			return err
+		}
+		policies, err := row.policies()
+		if err != nil {
+			return err
+		}
+		err = a.savePoliciesIncrementally(ctx, tx, policies)
+		if err != nil {
+			return err
+		}
+		return a.notifyReload(ctx, tx)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Can't restore snapshot '%s'", name)
+	}
+	return nil
+}
+
+// notifyReload sends RELOAD event to the channel of the trigger (see TriggerOptions.ChannelName). It is delivered on commit after events of changed rows.
+// PostgreSQL only
+func (a *BunAdapter) notifyReload(ctx context.Context, tx bun.Tx) error {
+	if a.dialectName() != dialect.PG {
+		return nil
+	}
+	var version sql.NullString
+	err := tx.QueryRowContext(ctx, "SELECT current_setting(?, true)", versionSettingName).Scan(&version)
+	if err != nil {
+		return err
+	}
+	// Schema and table are sent same as by trigger function, so listeners of other routed tables skip the reload
+	payload := TriggerDataPayload{
+		EventType: EVENT_PAYLOAD_RELOAD,
+		Schema:    a.matcher.SchemaName,
+		Table:     a.matcher.TableName,
+		New:       CasbinPolicy{Tenant: a.tenant},
+	}
+	if version.Valid && version.String != "" {
+		payload.Version, err = strconv.ParseInt(version.String, 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "Can't parse policy version '%s'", version.String)
+		}
+	}
+	metadata := a.changeMetadata(ctx)
+	payload.Actor, payload.Reason = metadata.Actor, metadata.Reason
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify(?, ?)", a.trigger.ChannelName, payload.String())
+	if err != nil {
+		return errors.Wrap(err, "Can't notify listeners about reload")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestSnapshots$' *.go -v
+func TestSnapshots(t *testing.T) {
+	matcher := MatcherOptions{TableName: "snapshot_policies"}
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(matcher), WithSnapshotTable("snapshot_policies_snapshot"), WithHistoryTable("snapshot_policies_log"))
+	ctx := context.Background()
+	assert.NoError(t, adapter.CreateSnapshotTable(ctx))
+	assert.NoError(t, adapter.CreateHistoryTable(ctx))
+
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	for _, rule := range [][]string{{"alice", "data1", "read", "allow"}, {"bob", "data2", "write", "allow"}} {
+		_, err := enforcer.AddPolicy(rule)
+		assert.NoError(t, err)
+	}
+	_, err := enforcer.AddGroupingPolicy("alice", "admin")
+	assert.NoError(t, err)
+
+	snapshot, err := adapter.CreateSnapshot(WithChangeMetadata(ctx, ChangeMetadata{Actor: "alice", Reason: "Reorganization"}), "before-reorg")
+	assert.NoError(t, err)
+	assert.Equal(t, "before-reorg", snapshot.Name)
+	assert.Equal(t, 3, snapshot.RuleCount)
+	_, err = adapter.CreateSnapshot(ctx, "before-reorg")
+	assert.ErrorIs(t, err, ErrSnapshotExists)
+
+	/* Duplicate name is rejected by the table itself (e.g. concurrent CreateSnapshot calls) */
+	_, err = adapter.NewInsert().
+		Model(&policySnapshotRow{Name: "before-reorg", Rules: "[]", CreatedAt: time.Now()}).
+		ModelTableExpr("?", bun.Ident("snapshot_policies_snapshot")).
+		Exec(ctx)
+	assert.Error(t, err)
+
+	/* Reorganization */
+	_, err = enforcer.RemoveFilteredPolicy(0, "alice")
+	assert.NoError(t, err)
+	_, err = enforcer.AddPolicy("carol", "data1", "read", "allow")
+	assert.NoError(t, err)
+
+	diff, err := adapter.DiffSnapshot(ctx, "before-reorg")
+	assert.NoError(t, err)
+	assert.False(t, diff.Empty())
+	if assert.Len(t, diff.Added, 1) && assert.Len(t, diff.Removed, 1) {
+		assert.Equal(t, []string{"carol", "data1", "read", "allow"}, diff.Added[0].getRuleDefinition())
+		assert.Equal(t, []string{"alice", "data1", "read", "allow"}, diff.Removed[0].getRuleDefinition())
+	}
+
+	/* Rollback */
+	assert.NoError(t, adapter.RestoreSnapshot(ctx, "before-reorg"))
+	assert.NoError(t, enforcer.LoadPolicy())
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"alice", "data1", "read", "allow"}, {"bob", "data2", "write", "allow"}}, policies)
+	diff, err = adapter.DiffSnapshot(ctx, "before-reorg")
+	assert.NoError(t, err)
+	assert.True(t, diff.Empty())
+
+	changes, err := adapter.QueryHistory(ctx, HistoryFilter{Subject: "carol"})
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, POLICY_OPERATION_DELETE, changes[1].Operation)
+	}
+
+	snapshots, err := adapter.ListSnapshots(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, snapshots, 1) {
+		assert.Equal(t, snapshot.ID, snapshots[0].ID)
+		assert.Equal(t, "alice", snapshots[0].Actor)
+		assert.Equal(t, "Reorganization", snapshots[0].Reason)
+	}
+
+	assert.ErrorIs(t, adapter.RestoreSnapshot(ctx, "missing"), ErrSnapshotNotFound)
+	_, err = NewBunAdapter(adapter.DB).ListSnapshots(ctx)
+	assert.Error(t, err)
+}
+
+// go test -run '^TestSnapshotConflictMSSQL$' *.go -v
+func TestSnapshotConflictMSSQL(t *testing.T) {
+	ctx := context.Background()
+	for _, number := range []int32{mssqlErrUniqueConstraint, mssqlErrUniqueIndex} {
+		// Snapshot with the same name is inserted concurrently after check for existing one
+		connector := &recordingConnector{fail: func(query string) error {
+			if strings.HasPrefix(query, "INSERT INTO") {
+				return mssqlTestError{number: number}
+			}
+			return nil
+		}}
+		adapter := newRecordingAdapter(mssqlTestDialect{pgdialect.New()}, connector, WithSnapshotTable(""))
+		_, err := adapter.CreateSnapshot(ctx, "before-reorg")
+		assert.ErrorIs(t, err, ErrSnapshotExists)
+	}
+
+	/* Other errors are kept as is */
+	assert.False(t, isMSSQLUniqueViolation(mssqlTestError{number: 547}))
+	assert.False(t, isMSSQLUniqueViolation(nil))
+}
+
+// go test -run '^TestReloadPayload$' *.go -v
+func TestReloadPayload(t *testing.T) {
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "reload_policies"}))
+	m, err := model.NewModelFromString(testRBACModel)
+	assert.NoError(t, err)
+	enforcer, err := casbin.NewSyncedEnforcer(m, adapter)
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+
+	reload := TriggerDataPayload{EventType: EVENT_PAYLOAD_RELOAD}
+	assert.NoError(t, adapter.applyTriggerPayload(enforcer, reload, reload.String()))
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 1)
+
+	/* Reload replaces batch */
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"bob", "data1", "read", "allow"}))
+	batch := coalescedBatch{ruleDefinition: adapter.ruleDefinition}
+	batch.push(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: NewCasbinPolicyFrom("p", []string{"carol", "data1", "read", "allow"})})
+	batch.push(reload)
+	assert.NoError(t, batch.apply(enforcer, 0))
+	policies, err = enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"alice", "data1", "read", "allow"}, {"bob", "data1", "read", "allow"}}, policies)
+
+	tenantAdapter := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{Tenant: "tenant"}), WithTenant("acme"))
+	_, ok := tenantAdapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_RELOAD, New: CasbinPolicy{Tenant: "other"}})
+	assert.False(t, ok)
+	_, ok = tenantAdapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_RELOAD, New: CasbinPolicy{Tenant: "acme"}})
+	assert.True(t, ok)
+
+	/* Reload announces its table, so listeners of other routed tables skip it */
+	connector := &recordingConnector{rows: func(query string) [][]driver.Value {
+		return [][]driver.Value{{"7"}}
+	}}
+	routed := newRecordingAdapter(pgdialect.New(), connector, WithMatcherOptions(MatcherOptions{SchemaName: "tenant_a", TableName: "potato_policies"}))
+	ctx := context.Background()
+	assert.NoError(t, routed.runTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		return routed.notifyReload(ctx, tx)
+	}))
+	statements := connector.Statements()
+	notified := indexOfStatement(statements, "pg_notify")
+	if assert.GreaterOrEqual(t, notified, 0) {
+		assert.Contains(t, statements[notified], `"schema":"tenant_a","table":"potato_policies"`)
+	}
+	announced := TriggerDataPayload{EventType: EVENT_PAYLOAD_RELOAD, Version: 7, Schema: "tenant_a", Table: "potato_policies"}
+	_, ok = routed.scopePayload(announced)
+	assert.True(t, ok)
+	other := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{SchemaName: "tenant_b", TableName: "potato_policies"}))
+	_, ok = other.scopePayload(announced)
+	assert.False(t, ok)
+}
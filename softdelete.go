@@ -0,0 +1,152 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrSoftDeleteNotSet is returned by Restore() and ListPolicies() when MatcherOptions.DeletedAt column is not set
+	ErrSoftDeleteNotSet = errors.New("Soft delete column is not set")
+	// ErrEmptyRestoreFilter is returned by Restore() when none of RestoreFilter fields is set
+	ErrEmptyRestoreFilter = errors.New("Restore filter is empty")
+)
+
+// softDelete returns true if removed rows are marked instead of deleting
+func (a *BunAdapter) softDelete() bool {
+	return a.matcher.DeletedAt != ""
+}
+
+// scopeLive restricts query by rows which are not soft-deleted
+func (a *BunAdapter) scopeLive(query bun.QueryBuilder) bun.QueryBuilder {
+	if !a.softDelete() {
+		return query
+	}
+	return query.Where("? IS NULL", bun.Name(a.matcher.DeletedAt))
+}
+
+// markDeleted marks live rows of current tenant matching the filter as deleted. Optional columns MatcherOptions.UpdatedAt, UpdatedBy and Reason are refreshed
+func (a *BunAdapter) markDeleted(ctx context.Context, tx bun.Tx, filter func(bun.QueryBuilder) bun.QueryBuilder) error {
+	now := time.Now().UTC()
+	values := a.applyTimestampColumns(a.applyMetadataColumns(ctx, map[string]interface{}{}, false), now, false)
+	values[a.matcher.DeletedAt] = now
+	res, err := a.newRowsUpdate(tx, values).
+		ApplyQueryBuilder(filter).
+		ApplyQueryBuilder(a.scopeTenant).
+		ApplyQueryBuilder(a.scopeLive).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	return countChanges(ctx, res)
+}
+
+// newRowsUpdate prepares UPDATE query setting the values
+func (a *BunAdapter) newRowsUpdate(tx bun.Tx, values map[string]interface{}) *bun.UpdateQuery {
+	query := tx.NewUpdate().
+		ModelTableExpr("?", a.policyTable())
+	for _, column := range a.insertedColumns(values) {
+		query = query.Set("? = ?", bun.Name(column), values[column])
+	}
+	return query
+}
+
+// purgeDeleted removes soft-deleted copy of the rule, so the same rule could be inserted again
+func (a *BunAdapter) purgeDeleted(ctx context.Context, tx bun.Tx, values map[string]interface{}) error {
+	if !a.softDelete() {
+		return nil
+	}
+	query := tx.NewDelete().
+		ModelTableExpr("?", a.policyTable()).
+		Where("? IS NOT NULL", bun.Name(a.matcher.DeletedAt))
+	for _, column := range a.ruleColumns() {
+		query = query.Where("? = ?", bun.Name(column), values[column])
+	}
+	_, err := query.Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Can't remove soft-deleted copy of policy")
+	}
+	return nil
+}
+
+// RestoreFilter selects soft-deleted rows for Restore(). Empty fields are not used, but at least one of them must be set
+type RestoreFilter struct {
+	// IDs of rows, e.g. from ListPolicies() with ListFilter.Deleted
+	IDs   []int
+	PType string
+	// Same as arguments of RemoveFilteredPolicy(). PType must be set for using them
+	FieldIndex  int
+	FieldValues []string
+	// Rows deleted within the window, e.g. by mistaken RemoveFilteredPolicy()
+	DeletedAfter  time.Time
+	DeletedBefore time.Time
+}
+
+// empty returns true if none of fields is set
+func (f RestoreFilter) empty() bool {
+	return len(f.IDs) == 0 && f.PType == "" && f.DeletedAfter.IsZero() && f.DeletedBefore.IsZero()
+}
+
+// Restore brings back soft-deleted rows (of current tenant if MatcherOptions.Tenant is set) matching the filter and returns number of restored rows.
+// Restored rows are recorded in history table as insertions and listeners receive them as INSERT events.
+// Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) Restore(ctx context.Context, filter RestoreFilter) (int, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !a.softDelete() {
+		return 0, errors.Wrap(ErrSoftDeleteNotSet, "Can't restore policies. Use MatcherOptions.DeletedAt")
+	}
+	if filter.empty() {
+		return 0, ErrEmptyRestoreFilter
+	}
+	if len(filter.IDs) > 0 && a.compat.withoutID {
+		return 0, errors.New("Can't restore policies by IDs, since table has no ID column")
+	}
+	deleted := func(query bun.QueryBuilder) bun.QueryBuilder {
+		query = query.Where("? IS NOT NULL", bun.Name(a.matcher.DeletedAt))
+		if len(filter.IDs) > 0 {
+			query = query.Where("? IN (?)", bun.Name(a.matcher.ID), bun.In(filter.IDs))
+		}
+		if filter.PType != "" {
+			query = a.fieldFilter(filter.PType, filter.FieldIndex, filter.FieldValues...)(query)
+		}
+		if !filter.DeletedAfter.IsZero() {
+			query = query.Where("? >= ?", bun.Name(a.matcher.DeletedAt), filter.DeletedAfter.UTC())
+		}
+		if !filter.DeletedBefore.IsZero() {
+			query = query.Where("? < ?", bun.Name(a.matcher.DeletedAt), filter.DeletedBefore.UTC())
+		}
+		return query
+	}
+	var restored []CasbinPolicy
+	err = a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		restored, err = a.selectRows(ctx, tx, deleted)
+		if err != nil || len(restored) == 0 {
+			return err
+		}
+		values := a.applyTimestampColumns(a.applyMetadataColumns(ctx, map[string]interface{}{}, false), time.Now().UTC(), false)
+		values[a.matcher.DeletedAt] = nil
+		res, err := a.newRowsUpdate(tx, values).
+			ApplyQueryBuilder(deleted).
+			ApplyQueryBuilder(a.scopeTenant).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		err = countChanges(ctx, res)
+		if err != nil {
+			return err
+		}
+		return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, restored)
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "Can't restore policies")
+	}
+	return len(restored), nil
+}
@@ -0,0 +1,113 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestSoftDelete$' *.go -v
+func TestSoftDelete(t *testing.T) {
+	matcher := MatcherOptions{TableName: "soft_policies", DeletedAt: "deleted_at", UpdatedBy: "updated_by"}
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(matcher), WithHistoryTable("soft_policies_log"))
+	ctx := context.Background()
+	assert.NoError(t, adapter.CreateHistoryTable(ctx))
+	report, err := adapter.IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	for _, rule := range [][]string{{"alice", "data1", "read", "allow"}, {"alice", "data2", "write", "allow"}, {"bob", "data1", "read", "allow"}} {
+		_, err = enforcer.AddPolicy(rule)
+		assert.NoError(t, err)
+	}
+
+	/* Mistaken removal */
+	removedAt := time.Now()
+	_, err = enforcer.RemoveFilteredPolicy(0, "alice")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcer.LoadPolicy())
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"bob", "data1", "read", "allow"}}, policies)
+
+	deleted, err := adapter.ListPolicies(ctx, ListFilter{Deleted: true})
+	assert.NoError(t, err)
+	if assert.Len(t, deleted, 2) {
+		assert.NotNil(t, deleted[0].DeletedAt)
+	}
+
+	restored, err := adapter.Restore(WithChangeMetadata(ctx, ChangeMetadata{Actor: "admin"}), RestoreFilter{DeletedAfter: removedAt.Add(-time.Second)})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restored)
+	assert.NoError(t, enforcer.LoadPolicy())
+	policies, err = enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 3)
+	records, err := adapter.ListPolicies(ctx, ListFilter{PType: "p", FieldIndex: 0, FieldValues: []string{"alice"}})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Nil(t, records[0].DeletedAt)
+		assert.Equal(t, "admin", records[0].UpdatedBy)
+	}
+
+	/* Restore by ID */
+	_, err = enforcer.RemovePolicy("bob", "data1", "read", "allow")
+	assert.NoError(t, err)
+	deleted, err = adapter.ListPolicies(ctx, ListFilter{Deleted: true})
+	assert.NoError(t, err)
+	if assert.Len(t, deleted, 1) {
+		restored, err = adapter.Restore(ctx, RestoreFilter{IDs: []int{deleted[0].ID}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, restored)
+	}
+
+	/* Adding removed rule again replaces soft-deleted copy */
+	_, err = enforcer.RemovePolicy("bob", "data1", "read", "allow")
+	assert.NoError(t, err)
+	_, err = enforcer.AddPolicy("bob", "data1", "read", "allow")
+	assert.NoError(t, err)
+	deleted, err = adapter.ListPolicies(ctx, ListFilter{Deleted: true})
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 0)
+
+	/* SavePolicy marks rules as deleted */
+	_, err = enforcer.RemovePolicy("bob", "data1", "read", "allow")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcer.SavePolicy())
+	deleted, err = adapter.ListPolicies(ctx, ListFilter{Deleted: true})
+	assert.NoError(t, err)
+	assert.Len(t, deleted, 1)
+
+	changes, err := adapter.QueryHistory(ctx, HistoryFilter{Subject: "alice"})
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 6) {
+		assert.Equal(t, POLICY_OPERATION_DELETE, changes[2].Operation)
+		assert.Equal(t, POLICY_OPERATION_INSERT, changes[4].Operation)
+		assert.Equal(t, "admin", changes[4].Actor)
+	}
+
+	_, err = adapter.Restore(ctx, RestoreFilter{})
+	assert.ErrorIs(t, err, ErrEmptyRestoreFilter)
+	_, err = NewBunAdapter(adapter.DB).Restore(ctx, RestoreFilter{PType: "p"})
+	assert.ErrorIs(t, err, ErrSoftDeleteNotSet)
+}
+
+// go test -run '^TestScopePayloadSoftDelete$' *.go -v
+func TestScopePayloadSoftDelete(t *testing.T) {
+	adapter := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{DeletedAt: "deleted_at"}))
+	deletedAt := time.Now()
+	live := CasbinPolicy{PType: "p", V0: "bob"}
+	deleted := CasbinPolicy{PType: "p", V0: "bob", DeletedAt: &deletedAt}
+
+	payload, ok := adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_UPDATE, Old: live, New: deleted})
+	assert.True(t, ok)
+	assert.Equal(t, EVENT_PAYLOAD_DELETE, payload.EventType)
+	payload, ok = adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_UPDATE, Old: deleted, New: live})
+	assert.True(t, ok)
+	assert.Equal(t, EVENT_PAYLOAD_INSERT, payload.EventType)
+	_, ok = adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_DELETE, Old: deleted})
+	assert.False(t, ok)
+}
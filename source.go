@@ -0,0 +1,105 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun/dialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// ChangeSource produces policy change events. Run must block until ctx is done or error occurs
+// and it must stop sending events as soon as ctx is done
+type ChangeSource interface {
+	Run(ctx context.Context, events chan<- TriggerDataPayload) error
+}
+
+// notifySource receives change events sent by trigger function via pg_notify
+type notifySource struct {
+	adapter *BunAdapter
+}
+
+// NotifySource returns change source which listens to the channel of trigger prepared by PrepareTrigger()
+func (a *BunAdapter) NotifySource() ChangeSource {
+	return &notifySource{adapter: a}
+}
+
+// Run listens to the database channel until listener is closed or ctx is done
+func (src *notifySource) Run(ctx context.Context, events chan<- TriggerDataPayload) error {
+	err := src.adapter.requireDialect("LISTEN/NOTIFY", dialect.PG)
+	if err != nil {
+		return err
+	}
+	ln := pgdriver.NewListener(src.adapter.DB)
+	defer ln.Close()
+	err = ln.Listen(ctx, src.adapter.trigger.ChannelName)
+	if err != nil {
+		return errors.Wrap(err, "Can't initialize database LISTEN")
+	}
+	dbChanMessages := ln.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-dbChanMessages:
+			if !ok {
+				return nil
+			}
+			payloadData := TriggerDataPayload{}
+			err = json.Unmarshal([]byte(msg.Payload), &payloadData)
+			if err != nil {
+				return errors.Wrapf(err, "Can't read payload from database. Payload is: '%s'", msg.Payload)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case events <- payloadData:
+			}
+		}
+	}
+}
+
+// StartChangesListening applies every change produced by the source to the enforcer. It blocks until source stops or error occurs.
+// Use WithCoalescing() and WithReloadThreshold() options for bulk updates
+func (a *BunAdapter) StartChangesListening(ctx context.Context, source ChangeSource, enforcer *casbin.SyncedEnforcer, opts ...func(*ListenOptions)) error {
+	listenOpts := ListenOptions{}
+	for _, opt := range opts {
+		opt(&listenOpts)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := make(chan TriggerDataPayload)
+	sourceErr := make(chan error, 1)
+	go func() {
+		sourceErr <- source.Run(ctx, events)
+		close(events)
+	}()
+	var err error
+	if listenOpts.CoalesceWindow > 0 {
+		err = a.applyCoalesced(enforcer, events, listenOpts)
+	} else {
+		err = a.applyEach(enforcer, events)
+	}
+	if err != nil {
+		return err
+	}
+	return <-sourceErr
+}
+
+// applyEach applies events to the enforcer one by one
+func (a *BunAdapter) applyEach(enforcer *casbin.SyncedEnforcer, events <-chan TriggerDataPayload) error {
+	for payloadData := range events {
+		payloadData, ok := a.scopePayload(payloadData)
+		if !ok {
+			continue
+		}
+		err := a.applyTriggerPayload(enforcer, payloadData, payloadData.String())
+		if err != nil {
+			return err
+		}
+		a.applied.advance(payloadData.Version)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+	"github.com/uptrace/bun/driver/sqliteshim"
+)
+
+// sqliteDatabases counts in-memory databases, so every newSQLiteDB() call gets its own one
+var sqliteDatabases int64
+
+func newSQLiteDB(t *testing.T) *bun.DB {
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:%s-%d?mode=memory&cache=shared", name, atomic.AddInt64(&sqliteDatabases, 1))
+	sqldb, err := sql.Open(sqliteshim.ShimName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Connections of shared cache lock each other, so single connection is used
+	sqldb.SetMaxOpenConns(1)
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func newSQLiteAdapter(t *testing.T, opts ...func(*BunAdapter)) *BunAdapter {
+	adapter := NewBunAdapter(newSQLiteDB(t), opts...)
+	err := adapter.CreateTable(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return adapter
+}
+
+func newTestEnforcerWithAdapter(t *testing.T, adapter *BunAdapter) *casbin.Enforcer {
+	m, err := model.NewModelFromString(testRBACModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer, err := casbin.NewEnforcer(m, adapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enforcer
+}
+
+// go test -run '^TestSQLiteAdapter$' *.go -v
+func TestSQLiteAdapter(t *testing.T) {
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{
+		TableName: "potato_policies",
+		PType:     "pt",
+		V1:        "haha",
+	}))
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+
+	/* AutoSave */
+	_, err := enforcer.AddPolicy("alice", "data1", "read", "allow")
+	assert.NoError(t, err)
+	_, err = enforcer.AddPolicy("bob", "data2", "write", "allow")
+	assert.NoError(t, err)
+	_, err = enforcer.AddGroupingPolicy("alice", "data2_admin")
+	assert.NoError(t, err)
+	// Duplicates must be ignored by the database
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+
+	rows, err := adapter.selectPolicies(context.Background(), adapter.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	_, err = enforcer.RemovePolicy("bob", "data2", "write", "allow")
+	assert.NoError(t, err)
+	_, err = enforcer.RemoveFilteredGroupingPolicy(0, "alice")
+	assert.NoError(t, err)
+	rows, err = adapter.selectPolicies(context.Background(), adapter.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+
+	/* SavePolicy and LoadPolicy */
+	_, err = enforcer.AddPolicy("data2_admin", "data2", "read", "allow")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcer.SavePolicy())
+	assert.NoError(t, enforcer.LoadPolicy())
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"alice", "data1", "read", "allow"}, {"data2_admin", "data2", "read", "allow"}}, policies)
+
+	/* Triggers are PostgreSQL only */
+	assert.ErrorIs(t, adapter.PrepareTrigger(), ErrUnsupportedDialect)
+}
@@ -0,0 +1,101 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// UninstallOptions is for removing objects created by PrepareTrigger()
+type UninstallOptions struct {
+	// If function needed to be dropped too. Function could be shared by triggers of other tables, so it is kept by default
+	DropFunction bool
+	// If single-row table holding sequence of changes needed to be dropped too
+	DropVersionTable bool
+	// If nothing needed to be changed. Report contains objects and statements which would be dropped and executed
+	DryRun bool
+}
+
+// UninstallReport describes result of Uninstall()
+type UninstallReport struct {
+	// If nothing has been changed
+	DryRun bool
+	// Objects which have been dropped (or would be dropped in dry-run mode). Objects which do not exist are not listed
+	Dropped []string
+	// Statements which have been executed (or would be executed in dry-run mode)
+	Statements []string
+}
+
+// triggerObject is object created by PrepareTrigger()
+type triggerObject struct {
+	description string
+	existsQuery string
+	existsArgs  []interface{}
+	drop        string
+}
+
+// DropTrigger removes trigger created by PrepareTrigger(). Function and version table are kept
+func (a *BunAdapter) DropTrigger(ctx context.Context) (UninstallReport, error) {
+	return a.Uninstall(ctx, UninstallOptions{})
+}
+
+// Uninstall removes trigger created by PrepareTrigger() and optionally its function and version table.
+// Everything is done in single transaction. Objects which do not exist are skipped
+func (a *BunAdapter) Uninstall(ctx context.Context, opts UninstallOptions) (UninstallReport, error) {
+	report := UninstallReport{DryRun: opts.DryRun}
+	statements, err := a.TriggerSQL()
+	if err != nil {
+		return report, err
+	}
+	objects := []triggerObject{{
+		description: fmt.Sprintf("trigger %s on %s", pgQuoteIdent(a.triggerName()), pgQuoteQualified(a.matcher.SchemaName, a.matcher.TableName)),
+		existsQuery: "SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = ? AND tgrelid = to_regclass(?))",
+		existsArgs:  []interface{}{a.triggerName(), pgQuoteQualified(a.matcher.SchemaName, a.matcher.TableName)},
+		drop:        statements.DropTrigger,
+	}}
+	if opts.DropFunction {
+		functionName := a.functionIdent() + "()"
+		objects = append(objects, triggerObject{
+			description: "function " + functionName,
+			existsQuery: "SELECT to_regprocedure(?) IS NOT NULL",
+			existsArgs:  []interface{}{functionName},
+			drop:        statements.DropFunction,
+		})
+	}
+	if opts.DropVersionTable {
+		tableName := a.versionTableIdent()
+		objects = append(objects, triggerObject{
+			description: "table " + tableName,
+			existsQuery: "SELECT to_regclass(?) IS NOT NULL",
+			existsArgs:  []interface{}{tableName},
+			drop:        statements.DropVersionTable,
+		})
+	}
+	err = a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		for _, object := range objects {
+			var exists bool
+			err := tx.QueryRowContext(ctx, object.existsQuery, object.existsArgs...).Scan(&exists)
+			if err != nil {
+				return errors.Wrapf(err, "Can't check existence of %s", object.description)
+			}
+			if !exists {
+				continue
+			}
+			if !opts.DryRun {
+				_, err = tx.ExecContext(ctx, object.drop)
+				if err != nil {
+					return errors.Wrapf(err, "Can't drop %s", object.description)
+				}
+			}
+			report.Dropped = append(report.Dropped, object.description)
+			report.Statements = append(report.Statements, object.drop)
+		}
+		return nil
+	})
+	if err != nil {
+		return UninstallReport{DryRun: opts.DryRun}, err
+	}
+	return report, nil
+}
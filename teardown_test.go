@@ -0,0 +1,63 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestUninstall$' *.go -v
+func TestUninstall(t *testing.T) {
+	// Trigger and version table exist, function has been dropped already
+	connector := &recordingConnector{rows: func(query string) [][]driver.Value {
+		switch {
+		case strings.Contains(query, "pg_trigger"):
+			return [][]driver.Value{{true}}
+		case strings.Contains(query, "to_regprocedure"):
+			return [][]driver.Value{{false}}
+		default:
+			return [][]driver.Value{{true}}
+		}
+	}}
+	adapter := newRecordingAdapter(pgdialect.New(), connector, WithMatcherOptions(MatcherOptions{SchemaName: "dev", TableName: "potato_policies"}))
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	opts := UninstallOptions{DropFunction: true, DropVersionTable: true, DryRun: true}
+
+	report, err := adapter.Uninstall(ctx, opts)
+	assert.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{
+		`trigger "dev_potato_policies_casbin_trigger" on "dev"."potato_policies"`,
+		`table "public"."casbin_policy_version"`,
+	}, report.Dropped)
+	assert.Equal(t, []string{statements.DropTrigger, statements.DropVersionTable}, report.Statements)
+	for _, statement := range connector.Statements() {
+		assert.False(t, strings.HasPrefix(statement, "DROP"), statement)
+	}
+
+	/* Reported statements are executed */
+	connector.statements = nil
+	opts.DryRun = false
+	report, err = adapter.Uninstall(ctx, opts)
+	assert.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Len(t, report.Dropped, 2)
+	var executed []string
+	for _, statement := range connector.Statements() {
+		if strings.HasPrefix(statement, "DROP") {
+			executed = append(executed, statement)
+		}
+	}
+	assert.Equal(t, report.Statements, executed)
+
+	/* Only trigger is dropped by default */
+	report, err = adapter.DropTrigger(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{statements.DropTrigger}, report.Statements)
+}
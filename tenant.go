@@ -0,0 +1,84 @@
+package casbinbunadapter
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrTenantNotSet is returned when only one of MatcherOptions.Tenant and WithTenant() is provided
+	ErrTenantNotSet = errors.New("Tenant is not set")
+)
+
+// WithTenant scopes adapter by tenant: every read, write, SavePolicy() cleanup and listener is restricted by rows which
+// MatcherOptions.Tenant column is equal to the value. Adapters of different tenants could share the same table
+func WithTenant(tenant string) func(*BunAdapter) {
+	return func(a *BunAdapter) {
+		a.tenant = tenant
+	}
+}
+
+// Tenant returns value provided via WithTenant()
+func (a *BunAdapter) Tenant() string {
+	return a.tenant
+}
+
+// validateTenant checks that tenant column and tenant value are provided together
+func (a *BunAdapter) validateTenant() error {
+	if a.matcher.Tenant != "" && a.tenant == "" {
+		return errors.Wrapf(ErrTenantNotSet, "Column '%s' is set via MatcherOptions.Tenant, but tenant value is empty. Use WithTenant()", a.matcher.Tenant)
+	}
+	if a.matcher.Tenant == "" && a.tenant != "" {
+		return errors.Wrapf(ErrTenantNotSet, "Tenant '%s' is set via WithTenant(), but MatcherOptions.Tenant column is empty", a.tenant)
+	}
+	return nil
+}
+
+// scopeTenant restricts query by current tenant
+func (a *BunAdapter) scopeTenant(query bun.QueryBuilder) bun.QueryBuilder {
+	if a.matcher.Tenant == "" {
+		return query
+	}
+	return query.Where("? = ?", bun.Name(a.matcher.Tenant), a.tenant)
+}
+
+// scopePayload drops change of other tables and tenants, of rules which are not valid now and of soft-deleted rows. Update moving rule between tenants
+// (or changing its validity window, soft delete and restoring) is seen as insertion or deletion. Payload without table (e.g. sent by function
+// of previous versions of the adapter or by polling source) is treated as change of the adapter table
+func (a *BunAdapter) scopePayload(payload TriggerDataPayload) (TriggerDataPayload, bool) {
+	if payload.Table != "" && (payload.Schema != a.matcher.SchemaName || payload.Table != a.matcher.TableName) {
+		return payload, false
+	}
+	if a.matcher.Tenant == "" && !a.hasValidity() && !a.softDelete() {
+		return payload, true
+	}
+	now := time.Now()
+	owned := func(policy CasbinPolicy) bool {
+		return policy.Tenant == a.tenant && policy.validAt(now) && policy.DeletedAt == nil
+	}
+	switch payload.EventType {
+	case EVENT_PAYLOAD_RELOAD:
+		return payload, payload.New.Tenant == a.tenant
+	case EVENT_PAYLOAD_INSERT:
+		return payload, owned(payload.New)
+	case EVENT_PAYLOAD_DELETE:
+		return payload, owned(payload.Old)
+	case EVENT_PAYLOAD_UPDATE:
+		oldOwned, newOwned := owned(payload.Old), owned(payload.New)
+		switch {
+		case oldOwned && newOwned:
+			return payload, true
+		case newOwned:
+			payload.EventType = EVENT_PAYLOAD_INSERT
+			payload.Old = CasbinPolicy{}
+			return payload, true
+		case oldOwned:
+			payload.EventType = EVENT_PAYLOAD_DELETE
+			payload.New = CasbinPolicy{}
+			return payload, true
+		}
+	}
+	return payload, false
+}
@@ -0,0 +1,87 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestTenantScope$' *.go -v
+func TestTenantScope(t *testing.T) {
+	matcher := MatcherOptions{TableName: "tenant_policies", Tenant: "tenant_id"}
+	adapterA := newSQLiteAdapter(t, WithMatcherOptions(matcher), WithTenant("a"))
+	adapterB := NewBunAdapter(adapterA.DB, WithMatcherOptions(matcher), WithTenant("b"))
+	enforcerA := newTestEnforcerWithAdapter(t, adapterA)
+	enforcerB := newTestEnforcerWithAdapter(t, adapterB)
+
+	_, err := enforcerA.AddPolicy("alice", "data1", "read", "allow")
+	assert.NoError(t, err)
+	// The same rule is allowed for other tenant
+	_, err = enforcerB.AddPolicy("alice", "data1", "read", "allow")
+	assert.NoError(t, err)
+	_, err = enforcerB.AddPolicy("bob", "data2", "write", "allow")
+	assert.NoError(t, err)
+
+	rows, err := adapterA.selectPolicies(context.Background(), adapterA.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "a", rows[0].Tenant)
+
+	/* Removal and SavePolicy must not touch other tenant */
+	_, err = enforcerA.RemoveFilteredPolicy(0, "alice")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcerA.SavePolicy())
+	rows, err = adapterB.selectPolicies(context.Background(), adapterB.DB)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	/* Validation */
+	_, err = OpenBunAdapter(adapterA.DB, WithMatcherOptions(matcher))
+	assert.ErrorIs(t, err, ErrTenantNotSet)
+	_, err = OpenBunAdapter(adapterA.DB, WithTenant("a"))
+	assert.ErrorIs(t, err, ErrTenantNotSet)
+}
+
+// go test -run '^TestTenantPayload$' *.go -v
+func TestTenantPayload(t *testing.T) {
+	adapter := NewBunAdapter(nil, WithMatcherOptions(MatcherOptions{Tenant: "tenant_id"}), WithTenant("a"))
+	own := CasbinPolicy{PType: "p", V0: "alice", Tenant: "a"}
+	other := CasbinPolicy{PType: "p", V0: "alice", Tenant: "b"}
+
+	_, ok := adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: other})
+	assert.False(t, ok)
+	_, ok = adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_DELETE, Old: own})
+	assert.True(t, ok)
+	payload, ok := adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_UPDATE, Old: other, New: own})
+	assert.True(t, ok)
+	assert.Equal(t, EVENT_PAYLOAD_INSERT, payload.EventType)
+	payload, ok = adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_UPDATE, Old: own, New: other})
+	assert.True(t, ok)
+	assert.Equal(t, EVENT_PAYLOAD_DELETE, payload.EventType)
+
+	// Adapter without tenant column accepts everything
+	_, ok = NewBunAdapter(nil).scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: other})
+	assert.True(t, ok)
+}
+
+// go test -run '^TestTenantSQL$' *.go -v
+func TestTenantSQL(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{Tenant: "tenant_id"}), WithTenant("a"))
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, ddl, `"tenant_id" varchar(256) NOT NULL`)
+	assert.Contains(t, ddl, `UNIQUE ("tenant_id", "ptype", "v0", "v1", "v2", "v3", "v4", "v5")`)
+
+	values := adapter.policyValues(NewCasbinPolicyFrom("p", []string{"alice"}))
+	assert.Equal(t, "a", values["tenant_id"])
+	query := adapter.newIgnoringInsert(adapter.DB, values).String()
+	assert.Contains(t, query, `ON CONFLICT ("tenant_id", "ptype", "v0", "v1", "v2", "v3", "v4", "v5") DO NOTHING`)
+
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.Function, `'tenant', new."tenant_id"`)
+	assert.Contains(t, statements.Function, `'tenant', old."tenant_id"`)
+	assert.Equal(t, "tenant_id", adapter.expectedFunctionMarker().Columns["tenant"])
+}
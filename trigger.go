@@ -8,237 +8,405 @@ import (
 	"github.com/casbin/casbin/v2"
 	"github.com/pkg/errors"
 	"github.com/uptrace/bun"
-	"github.com/uptrace/bun/driver/pgdriver"
+	"github.com/uptrace/bun/dialect"
 )
 
 var (
 	triggerTemplate = `
-  create%[1]s trigger %[2]s_%[3]s_%[4]s
+  create%[1]s trigger %[2]s
   after
   insert or update or delete
   on
-  %[2]s.%[3]s for each row execute function
-  %[5]s.%[6]s();
+  %[3]s for each row execute function
+  %[4]s();
   `
 	triggerProcedureTemplate = `
-  CREATE%[1]s FUNCTION %[2]s.%[3]s()
+  CREATE%[1]s FUNCTION %[2]s()
   RETURNS trigger
   LANGUAGE plpgsql
-  AS $function$
+  AS %[3]s
+  ;
+	`
+	triggerProcedureBodyTemplate = `
+    declare
+      policy_version int8;
     begin
+      update %[1]s set version = version + 1 where id = 1 returning version into policy_version;
+      perform set_config(%[2]s, policy_version::text, true);
       if TG_OP = 'INSERT' then
         perform pg_notify(
-          '%[4]s',
+          %[3]s,
 					jsonb_build_object(
-						'event_type', '%[13]s',
+						'event_type', %[12]s,
+						'version', policy_version,
+						'schema', TG_TABLE_SCHEMA,
+						'table', TG_TABLE_NAME,
+						'actor', nullif(current_setting(%[18]s, true), ''),
+						'reason', nullif(current_setting(%[19]s, true), ''),
 						'new', jsonb_build_object(
-							'id', new.%[5]s,
-							'ptype', new.%[6]s,
-							'v0', new.%[7]s,
-							'v1', new.%[8]s,
-							'v2', new.%[9]s,
-							'v3', new.%[10]s,
-							'v4', new.%[11]s,
-							'v5', new.%[12]s
+							'id', %[4]s,
+							'ptype', new.%[5]s,
+							'v0', new.%[6]s,
+							'v1', new.%[7]s,
+							'v2', new.%[8]s,
+							'v3', new.%[9]s,
+							'v4', new.%[10]s,
+							'v5', new.%[11]s,
+							'tenant', %[16]s%[20]s
 						)
 					)::text
         );
       end if;
       if TG_OP = 'UPDATE' then
         perform pg_notify(
-          '%[4]s',
+          %[3]s,
 					jsonb_build_object(
-						'event_type', '%[14]s',
+						'event_type', %[13]s,
+						'version', policy_version,
+						'schema', TG_TABLE_SCHEMA,
+						'table', TG_TABLE_NAME,
+						'actor', nullif(current_setting(%[18]s, true), ''),
+						'reason', nullif(current_setting(%[19]s, true), ''),
 						'new', jsonb_build_object(
-							'id', new.%[5]s,
-							'ptype', new.%[6]s,
-							'v0', new.%[7]s,
-							'v1', new.%[8]s,
-							'v2', new.%[9]s,
-							'v3', new.%[10]s,
-							'v4', new.%[11]s,
-							'v5', new.%[12]s
+							'id', %[4]s,
+							'ptype', new.%[5]s,
+							'v0', new.%[6]s,
+							'v1', new.%[7]s,
+							'v2', new.%[8]s,
+							'v3', new.%[9]s,
+							'v4', new.%[10]s,
+							'v5', new.%[11]s,
+							'tenant', %[16]s%[20]s
 						),
 						'old', jsonb_build_object(
-							'id', old.%[5]s,
-							'ptype', old.%[6]s,
-							'v0', old.%[7]s,
-							'v1', old.%[8]s,
-							'v2', old.%[9]s,
-							'v3', old.%[10]s,
-							'v4', old.%[11]s,
-							'v5', old.%[12]s
+							'id', %[15]s,
+							'ptype', old.%[5]s,
+							'v0', old.%[6]s,
+							'v1', old.%[7]s,
+							'v2', old.%[8]s,
+							'v3', old.%[9]s,
+							'v4', old.%[10]s,
+							'v5', old.%[11]s,
+							'tenant', %[17]s%[21]s
 						)
 					)::text
         );
       end if;
       if TG_OP = 'DELETE' then
         perform pg_notify(
-          '%[4]s',
+          %[3]s,
 					jsonb_build_object(
-						'event_type', '%[15]s',
+						'event_type', %[14]s,
+						'version', policy_version,
+						'schema', TG_TABLE_SCHEMA,
+						'table', TG_TABLE_NAME,
+						'actor', nullif(current_setting(%[18]s, true), ''),
+						'reason', nullif(current_setting(%[19]s, true), ''),
 						'old', jsonb_build_object(
-							'id', old.%[5]s,
-							'ptype', old.%[6]s,
-							'v0', old.%[7]s,
-							'v1', old.%[8]s,
-							'v2', old.%[9]s,
-							'v3', old.%[10]s,
-							'v4', old.%[11]s,
-							'v5', old.%[12]s
+							'id', %[15]s,
+							'ptype', old.%[5]s,
+							'v0', old.%[6]s,
+							'v1', old.%[7]s,
+							'v2', old.%[8]s,
+							'v3', old.%[9]s,
+							'v4', old.%[10]s,
+							'v5', old.%[11]s,
+							'tenant', %[17]s%[21]s
 						)
 					)::text
         );
       end if;
       RETURN NEW;
     end;
-  $function$
-  ;
+  `
+	versionTableTemplate = `
+  CREATE TABLE IF NOT EXISTS %[1]s (
+    id int4 DEFAULT 1 NOT NULL,
+    version int8 DEFAULT 0 NOT NULL,
+    CONSTRAINT %[2]s PRIMARY KEY (id),
+    CONSTRAINT %[3]s CHECK (id = 1)
+  );
+  INSERT INTO %[1]s (id, version) VALUES (1, 0) ON CONFLICT (id) DO NOTHING;
 	`
+	functionCommentTemplate  = `COMMENT ON FUNCTION %[1]s() IS %[2]s;`
+	dropTriggerTemplate      = `DROP TRIGGER IF EXISTS %[1]s ON %[2]s;`
+	dropFunctionTemplate     = `DROP FUNCTION IF EXISTS %[1]s();`
+	dropVersionTableTemplate = `DROP TABLE IF EXISTS %[1]s;`
 )
 
-// BuildTrigger creates function and trigger for sending database data changes payload.
-// It will check if function exists and if not creates it
-// It will check if trigger exists and if not creates it.
-// Finalized function name will match following template: "$SCHEMA_NAME$.$FUNCTION_NAME$"
-// Finalized trigger name will match following template: "$SCHEMA_NAME$_$TABLE_NAME$_$TRIGGER_NAME$"
-func (a *BunAdapter) PrepareTrigger() error {
+// TriggerStatements is SQL needed for sending database data changes payload. See TriggerSQL()
+type TriggerStatements struct {
+	// Creates single-row table holding sequence of changes
+	VersionTable string
+	// Creates function which sends payload
+	Function string
+	// Puts version marker on function. See InspectTrigger()
+	FunctionComment string
+	// Creates trigger on the policy table
+	Trigger string
+	// Drops trigger
+	DropTrigger string
+	// Drops function
+	DropFunction string
+	// Drops single-row table holding sequence of changes
+	DropVersionTable string
+}
+
+// Up returns statements creating trigger in order of execution. Function and trigger are created via CREATE
+// (unless TriggerOptions.FunctionReplace and TriggerOptions.TriggerReplace are set), so statements fail when they exist already
+func (ts TriggerStatements) Up() []string {
+	return []string{ts.VersionTable, ts.Function, ts.FunctionComment, ts.Trigger}
+}
+
+// Down returns statements dropping trigger in order of execution
+func (ts TriggerStatements) Down() []string {
+	return []string{ts.DropTrigger, ts.DropFunction, ts.DropVersionTable}
+}
+
+// TriggerSQL returns statements creating trigger for current MatcherOptions and TriggerOptions (and statements for reverting them).
+// PrepareTrigger() executes the same statements, but function and trigger are created only when they do not exist (or when TriggerOptions.FunctionReplace
+// and TriggerOptions.TriggerReplace are set). Nothing is executed, so statements could be reviewed and applied by migration tool. See TriggerMigration()
+func (a *BunAdapter) TriggerSQL() (TriggerStatements, error) {
+	err := a.requireDialect("TriggerSQL", dialect.PG)
+	if err != nil {
+		return TriggerStatements{}, err
+	}
+	return a.triggerStatements(a.trigger.FunctionReplace, a.trigger.TriggerReplace)
+}
+
+// triggerStatements prepares TriggerStatements. Replace flags override ones from TriggerOptions.
+// Every name is quoted and channel name is escaped, so options must be validated only for length (see Validate())
+func (a *BunAdapter) triggerStatements(functionReplace, triggerReplace bool) (TriggerStatements, error) {
+	err := a.Validate()
+	if err != nil {
+		return TriggerStatements{}, err
+	}
 	replaceTr := ""
-	if a.trigger.TriggerReplace {
+	if triggerReplace {
 		replaceTr = " OR REPLACE"
 	}
-	triggerBody := fmt.Sprintf(triggerTemplate, replaceTr, a.matcher.SchemaName, a.matcher.TableName, a.trigger.Name, a.trigger.FunctionSchemaName, a.trigger.FunctionName)
 	replaceFn := ""
-	if a.trigger.FunctionReplace {
+	if functionReplace {
 		replaceFn = " OR REPLACE"
 	}
-	triggerProcedureBody := fmt.Sprintf(triggerProcedureTemplate, replaceFn, a.trigger.FunctionSchemaName, a.trigger.FunctionName, a.trigger.ChannelName,
-		a.matcher.ID,
-		a.matcher.PType,
-		a.matcher.V0,
-		a.matcher.V1,
-		a.matcher.V2,
-		a.matcher.V3,
-		a.matcher.V4,
-		a.matcher.V5,
-		EVENT_PAYLOAD_INSERT,
-		EVENT_PAYLOAD_UPDATE,
-		EVENT_PAYLOAD_DELETE,
+	marker, err := a.expectedFunctionMarker().encode()
+	if err != nil {
+		return TriggerStatements{}, err
+	}
+	policyTable := pgQuoteQualified(a.matcher.SchemaName, a.matcher.TableName)
+	function := a.functionIdent()
+	versionTable := a.versionTableIdent()
+	trigger := pgQuoteIdent(a.triggerName())
+	functionBody := fmt.Sprintf(triggerProcedureBodyTemplate,
+		versionTable,
+		pgQuoteLiteral(versionSettingName),
+		pgQuoteLiteral(a.trigger.ChannelName),
+		a.triggerIDExpr("new"),
+		pgQuoteIdent(a.matcher.PType),
+		pgQuoteIdent(a.matcher.V0),
+		pgQuoteIdent(a.matcher.V1),
+		pgQuoteIdent(a.matcher.V2),
+		pgQuoteIdent(a.matcher.V3),
+		pgQuoteIdent(a.matcher.V4),
+		pgQuoteIdent(a.matcher.V5),
+		pgQuoteLiteral(string(EVENT_PAYLOAD_INSERT)),
+		pgQuoteLiteral(string(EVENT_PAYLOAD_UPDATE)),
+		pgQuoteLiteral(string(EVENT_PAYLOAD_DELETE)),
+		a.triggerIDExpr("old"),
+		a.triggerTenantExpr("new"),
+		a.triggerTenantExpr("old"),
+		pgQuoteLiteral(actorSettingName),
+		pgQuoteLiteral(reasonSettingName),
+		a.triggerTimestampFields("new"),
+		a.triggerTimestampFields("old"),
 	)
-	ctx := context.Background()
-	// We should run it in transaction since potential INSERT operation problem
-	err := a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
-		triggerProcedureQuery := fmt.Sprintf(
-			`
-				DO $$
-				begin
-				  %s	
-				EXCEPTION WHEN duplicate_function THEN RAISE NOTICE '%% already exists. Skipping trigger creation',
-				SQLERRM USING ERRCODE = SQLSTATE;
-				END $$;
-			`, triggerProcedureBody)
-		_, err := tx.ExecContext(ctx, triggerProcedureQuery)
-		if err != nil {
-			return err
+	return TriggerStatements{
+		VersionTable:     fmt.Sprintf(versionTableTemplate, versionTable, pgQuoteIdent(a.trigger.VersionTableName+"_pk"), pgQuoteIdent(a.trigger.VersionTableName+"_single_row")),
+		Function:         fmt.Sprintf(triggerProcedureTemplate, replaceFn, function, pgDollarQuote(functionBody)),
+		FunctionComment:  fmt.Sprintf(functionCommentTemplate, function, pgQuoteLiteral(marker)),
+		Trigger:          fmt.Sprintf(triggerTemplate, replaceTr, trigger, policyTable, function),
+		DropTrigger:      fmt.Sprintf(dropTriggerTemplate, trigger, policyTable),
+		DropFunction:     fmt.Sprintf(dropFunctionTemplate, function),
+		DropVersionTable: fmt.Sprintf(dropVersionTableTemplate, versionTable),
+	}, nil
+}
+
+// triggerName returns finalized trigger name: "$SCHEMA_NAME$_$TABLE_NAME$_$TRIGGER_NAME$"
+func (a *BunAdapter) triggerName() string {
+	return fmt.Sprintf("%s_%s_%s", a.matcher.SchemaName, a.matcher.TableName, a.trigger.Name)
+}
+
+// triggerIDExpr returns expression for ID of the row in trigger function. Zero is used for table without ID column
+func (a *BunAdapter) triggerIDExpr(row string) string {
+	if a.compat.withoutID {
+		return "0"
+	}
+	return row + "." + pgQuoteIdent(a.matcher.ID)
+}
+
+// triggerTenantExpr returns expression for tenant of the row in trigger function. Null is used when MatcherOptions.Tenant is not set
+func (a *BunAdapter) triggerTenantExpr(row string) string {
+	if a.matcher.Tenant == "" {
+		return "null"
+	}
+	return row + "." + pgQuoteIdent(a.matcher.Tenant)
+}
+
+// triggerTimestampFields returns additional payload fields for MatcherOptions.CreatedAt, UpdatedAt, ValidFrom, ValidTo and DeletedAt columns.
+// Values are converted to timestamptz, so JSON representation always has time zone
+func (a *BunAdapter) triggerTimestampFields(row string) string {
+	fields := ""
+	for _, column := range []struct {
+		field string
+		name  string
+	}{
+		{"created_at", a.matcher.CreatedAt},
+		{"updated_at", a.matcher.UpdatedAt},
+		{"valid_from", a.matcher.ValidFrom},
+		{"valid_to", a.matcher.ValidTo},
+		{"deleted_at", a.matcher.DeletedAt},
+	} {
+		if column.name == "" {
+			continue
 		}
-		triggerQuery := fmt.Sprintf(
-			`
-				DO $$
-				begin
-				  %s
-				EXCEPTION WHEN duplicate_object THEN RAISE NOTICE '%% already exists. Skipping trigger creation',
-				SQLERRM USING ERRCODE = SQLSTATE;
-				END $$;
-			`, triggerBody)
-		_, err = tx.ExecContext(ctx, triggerQuery)
-		return err
-	})
-	return err
+		fields += fmt.Sprintf(",\n\t\t\t\t\t\t\t%s, %s.%s::timestamptz", pgQuoteLiteral(column.field), row, pgQuoteIdent(column.name))
+	}
+	return fields
+}
+
+// functionIdent returns quoted schema-qualified name of the trigger function
+func (a *BunAdapter) functionIdent() string {
+	return pgQuoteQualified(a.trigger.FunctionSchemaName, a.trigger.FunctionName)
+}
+
+// versionTableIdent returns quoted schema-qualified name of the version table
+func (a *BunAdapter) versionTableIdent() string {
+	return pgQuoteQualified(a.trigger.FunctionSchemaName, a.trigger.VersionTableName)
+}
+
+// BuildTrigger creates function and trigger for sending database data changes payload.
+// It will check if function exists and if not creates it
+// It will check if trigger exists and if not creates it.
+// Finalized function name will match following template: "$SCHEMA_NAME$.$FUNCTION_NAME$"
+// Finalized trigger name will match following template: "$SCHEMA_NAME$_$TABLE_NAME$_$TRIGGER_NAME$"
+// Single-row table "$FUNCTION_SCHEMA_NAME$.$VERSION_TABLE_NAME$" holding sequence of changes will be created too
+// Existing function is not checked, so use InspectTrigger() and UpgradeTrigger() for detecting and replacing outdated one
+func (a *BunAdapter) PrepareTrigger() error {
+	return a.PrepareTriggerCtx(context.Background())
 }
 
-func (a *BunAdapter) StartUpdatesListening(enforcer *casbin.SyncedEnforcer) error {
-	dbChanMessages, err := a.initDBListener()
+// PrepareTriggerCtx is the same as PrepareTrigger(), but statements are executed with the context
+func (a *BunAdapter) PrepareTriggerCtx(ctx context.Context) error {
+	statements, err := a.TriggerSQL()
 	if err != nil {
-		return errors.Wrap(err, "Can't initialize database LISTEN")
+		return err
 	}
-	for msg := range dbChanMessages {
-		payloadStr := msg.Payload
-		payloadData := TriggerDataPayload{}
-		err = json.Unmarshal([]byte(payloadStr), &payloadData)
+	// We should run it in transaction since potential INSERT operation problem
+	err = a.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Concurrent calls are serialized, so existence checks below are reliable
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext(?))", a.functionIdent())
 		if err != nil {
-			return errors.Wrapf(err, "Can't read payload from database. Payload is: '%s'", payloadStr)
+			return err
 		}
-		switch payloadData.EventType {
-		case EVENT_PAYLOAD_INSERT:
-			ptype := payloadData.New.PType[:1]
-			switch ptype {
-			case "p":
-				_, err := enforcer.AddPolicy(payloadData.New.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad new policy. Policy is: '%s'", payloadStr)
-				}
-			case "g":
-				_, err := enforcer.AddGroupingPolicy(payloadData.New.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad new grouping policy. Policy is: '%s'", payloadStr)
-				}
-			}
-		case EVENT_PAYLOAD_UPDATE:
-			// Attention: since UPDATE method is implemented as cascade of Add/Remove policis functions then if something goes wrong in adding policies stage then previous removed policies won't roll back
-			ptypeOld := payloadData.Old.PType[:1]
-			switch ptypeOld {
-			case "p":
-				_, err := enforcer.RemovePolicy(payloadData.Old.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad old-updated policy. Policy is: '%s'", payloadStr)
-				}
-			case "g":
-				_, err := enforcer.RemoveGroupingPolicy(payloadData.Old.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad old-updated grouping policy. Policy is: '%s'", payloadStr)
-				}
-			}
-			ptypeNew := payloadData.New.PType[:1]
-			switch ptypeNew {
-			case "p":
-				_, err := enforcer.AddPolicy(payloadData.New.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad new-updated policy. Policy is: '%s'", payloadStr)
-				}
-			case "g":
-				_, err := enforcer.AddGroupingPolicy(payloadData.New.getRuleDefinition())
+		_, err = tx.ExecContext(ctx, statements.VersionTable)
+		if err != nil {
+			return err
+		}
+		inspection, err := a.inspectTrigger(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if !inspection.FunctionExists || a.trigger.FunctionReplace {
+			for _, statement := range []string{statements.Function, statements.FunctionComment} {
+				_, err = tx.ExecContext(ctx, statement)
 				if err != nil {
-					return errors.Wrapf(err, "Bad new-updated grouping policy. Policy is: '%s'", payloadStr)
+					return err
 				}
 			}
-		case EVENT_PAYLOAD_DELETE:
-			ptype := payloadData.Old.PType[:1]
-			switch ptype {
-			case "p":
-				_, err := enforcer.RemovePolicy(payloadData.Old.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad old policy. Policy is: '%s'", payloadStr)
-				}
-			case "g":
-				_, err := enforcer.RemoveGroupingPolicy(payloadData.Old.getRuleDefinition())
-				if err != nil {
-					return errors.Wrapf(err, "Bad old grouping policy. Policy is: '%s'", payloadStr)
-				}
+		}
+		if !inspection.TriggerExists || a.trigger.TriggerReplace {
+			_, err = tx.ExecContext(ctx, statements.Trigger)
+			if err != nil {
+				return err
 			}
 		}
-	}
+		return nil
+	})
+	return err
+}
 
-	return nil
+// StartUpdatesListening listens to the database channel and applies every change to the enforcer. It blocks until listener is closed or error occurs.
+// Use WithCoalescing() and WithReloadThreshold() options for bulk updates
+func (a *BunAdapter) StartUpdatesListening(enforcer *casbin.SyncedEnforcer, opts ...func(*ListenOptions)) error {
+	return a.StartChangesListening(context.Background(), a.NotifySource(), enforcer, opts...)
 }
 
-func (a *BunAdapter) initDBListener() (<-chan pgdriver.Notification, error) {
-	ctx := context.Background()
-	ln := pgdriver.NewListener(a.DB)
-	err := ln.Listen(ctx, a.trigger.ChannelName)
-	if err != nil {
-		return nil, err
+// applyTriggerPayload applies single change to the enforcer. Rules are built same way as LoadPolicy() does. Raw payload is used for errors only
+func (a *BunAdapter) applyTriggerPayload(enforcer *casbin.SyncedEnforcer, payloadData TriggerDataPayload, payloadStr string) error {
+	switch payloadData.EventType {
+	case EVENT_PAYLOAD_INSERT:
+		ptype := payloadData.New.PType[:1]
+		switch ptype {
+		case "p":
+			_, err := enforcer.AddPolicy(a.ruleDefinition(payloadData.New))
+			if err != nil {
+				return errors.Wrapf(err, "Bad new policy. Policy is: '%s'", payloadStr)
+			}
+		case "g":
+			_, err := enforcer.AddGroupingPolicy(a.ruleDefinition(payloadData.New))
+			if err != nil {
+				return errors.Wrapf(err, "Bad new grouping policy. Policy is: '%s'", payloadStr)
+			}
+		}
+	case EVENT_PAYLOAD_UPDATE:
+		// Attention: since UPDATE method is implemented as cascade of Add/Remove policis functions then if something goes wrong in adding policies stage then previous removed policies won't roll back
+		ptypeOld := payloadData.Old.PType[:1]
+		switch ptypeOld {
+		case "p":
+			_, err := enforcer.RemovePolicy(a.ruleDefinition(payloadData.Old))
+			if err != nil {
+				return errors.Wrapf(err, "Bad old-updated policy. Policy is: '%s'", payloadStr)
+			}
+		case "g":
+			_, err := enforcer.RemoveGroupingPolicy(a.ruleDefinition(payloadData.Old))
+			if err != nil {
+				return errors.Wrapf(err, "Bad old-updated grouping policy. Policy is: '%s'", payloadStr)
+			}
+		}
+		ptypeNew := payloadData.New.PType[:1]
+		switch ptypeNew {
+		case "p":
+			_, err := enforcer.AddPolicy(a.ruleDefinition(payloadData.New))
+			if err != nil {
+				return errors.Wrapf(err, "Bad new-updated policy. Policy is: '%s'", payloadStr)
+			}
+		case "g":
+			_, err := enforcer.AddGroupingPolicy(a.ruleDefinition(payloadData.New))
+			if err != nil {
+				return errors.Wrapf(err, "Bad new-updated grouping policy. Policy is: '%s'", payloadStr)
+			}
+		}
+	case EVENT_PAYLOAD_RELOAD:
+		err := enforcer.LoadPolicy()
+		if err != nil {
+			return errors.Wrapf(err, "Can't reload policy. Payload is: '%s'", payloadStr)
+		}
+	case EVENT_PAYLOAD_DELETE:
+		ptype := payloadData.Old.PType[:1]
+		switch ptype {
+		case "p":
+			_, err := enforcer.RemovePolicy(a.ruleDefinition(payloadData.Old))
+			if err != nil {
+				return errors.Wrapf(err, "Bad old policy. Policy is: '%s'", payloadStr)
+			}
+		case "g":
+			_, err := enforcer.RemoveGroupingPolicy(a.ruleDefinition(payloadData.Old))
+			if err != nil {
+				return errors.Wrapf(err, "Bad old grouping policy. Policy is: '%s'", payloadStr)
+			}
+		}
 	}
-	return ln.Channel(), nil
+	return nil
 }
 
 type TriggerEventPayloadType string
@@ -247,10 +415,30 @@ var (
 	EVENT_PAYLOAD_INSERT = TriggerEventPayloadType("EVENT_CASBIN_INSERT")
 	EVENT_PAYLOAD_UPDATE = TriggerEventPayloadType("EVENT_CASBIN_UPDATE")
 	EVENT_PAYLOAD_DELETE = TriggerEventPayloadType("EVENT_CASBIN_DELETE")
+	// EVENT_PAYLOAD_RELOAD means that whole policy must be reloaded, e.g. after RestoreSnapshot(). Old and New carry tenant only
+	EVENT_PAYLOAD_RELOAD = TriggerEventPayloadType("EVENT_CASBIN_RELOAD")
 )
 
 type TriggerDataPayload struct {
 	EventType TriggerEventPayloadType `json:"event_type"`
-	Old       CasbinPolicy            `json:"old"`
-	New       CasbinPolicy            `json:"new"`
+	// Sequential number of the change. It is zero for payloads produced by function prepared with previous versions of the adapter
+	Version int64        `json:"version"`
+	Old     CasbinPolicy `json:"old"`
+	New     CasbinPolicy `json:"new"`
+	// Who and why made the change. See WithChangeMetadata(). Empty for changes made bypassing adapter
+	Actor  string `json:"actor,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Schema and table of the changed row. Function is shared by triggers of every table, so listener drops changes of other tables.
+	// Empty for payloads produced by function prepared with previous versions of the adapter
+	Schema string `json:"schema,omitempty"`
+	Table  string `json:"table,omitempty"`
+}
+
+// String returns JSON representation of the payload
+func (payload TriggerDataPayload) String() string {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Sprintf("%+v", map[string]interface{}{"event_type": payload.EventType, "version": payload.Version, "old": payload.Old, "new": payload.New})
+	}
+	return string(data)
 }
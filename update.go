@@ -0,0 +1,110 @@
+package casbinbunadapter
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// UpdatePolicy updates a policy rule in the storage. Needed for AutoSave, see the ref. https://casbin.org/docs/adapters/#autosave
+func (a *BunAdapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicyCtx(context.Background(), sec, ptype, oldRule, newRule)
+}
+
+// UpdatePolicyCtx updates a policy rule in the storage. Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) UpdatePolicyCtx(ctx context.Context, sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePoliciesCtx(ctx, sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+// UpdatePolicies updates policy rules in the storage. Needed for AutoSave, see the ref. https://casbin.org/docs/adapters/#autosave
+func (a *BunAdapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return a.UpdatePoliciesCtx(context.Background(), sec, ptype, oldRules, newRules)
+}
+
+// UpdatePoliciesCtx updates policy rules in the storage within single transaction. Table is picked by resolver (see WithSchemaResolver()) if any.
+// Optional columns MatcherOptions.UpdatedAt, UpdatedBy and Reason are refreshed, MatcherOptions.CreatedAt and CreatedBy are kept as is
+func (a *BunAdapter) UpdatePoliciesCtx(ctx context.Context, sec string, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return errors.Errorf("Number of old rules (%d) differs from number of new rules (%d)", len(oldRules), len(newRules))
+	}
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		entries := make([]historyEntry, 0, len(oldRules))
+		for i := range oldRules {
+			oldPolicy := NewCasbinPolicyFrom(ptype, oldRules[i])
+			newPolicy := NewCasbinPolicyFrom(ptype, newRules[i])
+			values := a.updateValues(ctx, newPolicy)
+			query := tx.NewUpdate().
+				ModelTableExpr("?", a.policyTable())
+			for _, column := range a.insertedColumns(values) {
+				query = query.Set("? = ?", bun.Name(column), values[column])
+			}
+			err := a.purgeDeleted(ctx, tx, a.policyValues(newPolicy))
+			if err != nil {
+				return err
+			}
+			res, err := query.
+				ApplyQueryBuilder(a.policyFilter(oldPolicy)).
+				ApplyQueryBuilder(a.scopeTenant).
+				ApplyQueryBuilder(a.scopeLive).
+				Exec(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "Can't update single policy. Policy: %+v", oldPolicy)
+			}
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			markChanged(ctx, affected)
+			if affected > 0 {
+				entries = append(entries, historyEntry{old: &oldPolicy, new: &newPolicy})
+			}
+		}
+		return a.writeHistory(ctx, tx, POLICY_OPERATION_UPDATE, entries)
+	})
+}
+
+// UpdateFilteredPolicies removes policy rules that match the filter and adds new ones. Removed rules are returned. Needed for AutoSave, see the ref. https://casbin.org/docs/adapters/#autosave
+func (a *BunAdapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return a.UpdateFilteredPoliciesCtx(context.Background(), sec, ptype, newRules, fieldIndex, fieldValues...)
+}
+
+// UpdateFilteredPoliciesCtx removes policy rules that match the filter and adds new ones within single transaction. Removed rules are returned.
+// Table is picked by resolver (see WithSchemaResolver()) if any
+func (a *BunAdapter) UpdateFilteredPoliciesCtx(ctx context.Context, sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var oldRules [][]string
+	err = a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		removed, err := a.deletePolicies(ctx, tx, a.fieldFilter(ptype, fieldIndex, fieldValues...), true)
+		if err != nil {
+			return err
+		}
+		oldRules = make([][]string, 0, len(removed))
+		for _, policy := range removed {
+			oldRules = append(oldRules, a.ruleDefinition(policy))
+		}
+		inserted := make([]CasbinPolicy, 0, len(newRules))
+		for _, rule := range newRules {
+			policy := NewCasbinPolicyFrom(ptype, rule)
+			ok, err := a.insertPolicyIgnoringDuplicates(ctx, tx, a.insertValues(ctx, policy))
+			if err != nil {
+				return errors.Wrapf(err, "Can't insert single policy. Policy: %+v", policy)
+			}
+			if ok {
+				inserted = append(inserted, policy)
+			}
+		}
+		return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, inserted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return oldRules, nil
+}
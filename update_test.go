@@ -0,0 +1,90 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestUpdatePolicies$' *.go -v
+func TestUpdatePolicies(t *testing.T) {
+	matcher := MatcherOptions{TableName: "timestamp_policies", CreatedAt: "created_at", UpdatedAt: "updated_at", CreatedBy: "created_by", UpdatedBy: "updated_by"}
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(matcher), WithHistoryTable("timestamp_policies_log"))
+	ctx := context.Background()
+	assert.NoError(t, adapter.CreateHistoryTable(ctx))
+	var _ persist.UpdatableAdapter = adapter
+	var _ persist.ContextUpdatableAdapter = adapter
+
+	inserted := time.Now()
+	assert.NoError(t, adapter.AddPolicyCtx(WithChangeMetadata(ctx, ChangeMetadata{Actor: "alice"}), "p", "p", []string{"bob", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.AddPolicyCtx(ctx, "p", "p", []string{"carol", "data1", "read", "allow"}))
+	records, err := adapter.ListPolicies(ctx, ListFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, []string{"bob", "data1", "read", "allow"}, records[0].Rule)
+		assert.Equal(t, "alice", records[0].CreatedBy)
+		if assert.NotNil(t, records[0].CreatedAt) {
+			assert.WithinDuration(t, inserted, *records[0].CreatedAt, time.Minute)
+		}
+	}
+	createdAt := *records[0].CreatedAt
+	// Rows updated after the cutoff are not stale
+	cutoff := time.Now()
+
+	/* UpdatePolicy keeps insertion columns */
+	time.Sleep(10 * time.Millisecond)
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	updated, err := enforcer.UpdatePolicy([]string{"bob", "data1", "read", "allow"}, []string{"bob", "data1", "write", "allow"})
+	assert.NoError(t, err)
+	assert.True(t, updated)
+	records, err = adapter.ListPolicies(ctx, ListFilter{PType: "p", FieldIndex: 0, FieldValues: []string{"bob"}})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, []string{"bob", "data1", "write", "allow"}, records[0].Rule)
+		assert.Equal(t, "alice", records[0].CreatedBy)
+		assert.Equal(t, createdAt, *records[0].CreatedAt)
+		assert.True(t, records[0].UpdatedAt.After(createdAt))
+	}
+
+	/* Stale grants */
+	records, err = adapter.ListPolicies(ctx, ListFilter{UpdatedBefore: cutoff})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "carol", records[0].Rule[0])
+	}
+
+	/* UpdateFilteredPolicies */
+	oldRules, err := adapter.UpdateFilteredPolicies("p", "p", [][]string{{"dave", "data2", "read", "allow"}}, 1, "data1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"bob", "data1", "write", "allow"}, {"carol", "data1", "read", "allow"}}, oldRules)
+
+	changes, err := adapter.QueryHistory(ctx, HistoryFilter{Subject: "bob"})
+	assert.NoError(t, err)
+	if assert.Len(t, changes, 3) {
+		assert.Equal(t, POLICY_OPERATION_UPDATE, changes[1].Operation)
+		assert.Equal(t, []string{"bob", "data1", "read", "allow"}, changes[1].Old)
+		assert.Equal(t, []string{"bob", "data1", "write", "allow"}, changes[1].New)
+	}
+
+	assert.Error(t, adapter.UpdatePolicies("p", "p", [][]string{{"bob"}}, nil))
+	_, err = NewBunAdapter(adapter.DB, WithMatcherOptions(MatcherOptions{TableName: "timestamp_policies"})).ListPolicies(ctx, ListFilter{UpdatedBefore: time.Now()})
+	assert.Error(t, err)
+}
+
+// go test -run '^TestTimestampSQL$' *.go -v
+func TestTimestampSQL(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{CreatedAt: "created_at", UpdatedAt: "updated_at"}))
+	ddl, err := adapter.CreateTableSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, ddl, `"created_at" timestamptz NULL`)
+	assert.Contains(t, ddl, `"updated_at" timestamptz NULL`)
+
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.Function, `'created_at', new."created_at"::timestamptz`)
+	assert.Contains(t, statements.Function, `'updated_at', old."updated_at"::timestamptz`)
+}
@@ -0,0 +1,355 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var (
+	// ErrValidityNotSet is returned when validity window is used, but MatcherOptions.ValidFrom or MatcherOptions.ValidTo column is not set
+	ErrValidityNotSet = errors.New("Validity column is not set")
+
+	defaultValiditySchedulerOpts = ValiditySchedulerOptions{
+		Interval: time.Minute,
+	}
+)
+
+// hasValidity returns true if any of validity columns is set
+func (a *BunAdapter) hasValidity() bool {
+	return a.matcher.ValidFrom != "" || a.matcher.ValidTo != ""
+}
+
+// scopeValidity restricts query by rules which are valid at the time. Nil is returned when validity columns are not set
+func (a *BunAdapter) scopeValidity(now time.Time) func(bun.QueryBuilder) bun.QueryBuilder {
+	if !a.hasValidity() {
+		return nil
+	}
+	return func(query bun.QueryBuilder) bun.QueryBuilder {
+		if a.matcher.ValidFrom != "" {
+			query = query.Where("(? IS NULL OR ? <= ?)", bun.Name(a.matcher.ValidFrom), bun.Name(a.matcher.ValidFrom), now)
+		}
+		if a.matcher.ValidTo != "" {
+			query = query.Where("(? IS NULL OR ? > ?)", bun.Name(a.matcher.ValidTo), bun.Name(a.matcher.ValidTo), now)
+		}
+		return query
+	}
+}
+
+// scopeWindowed restricts query by rules which have validity window, i.e. at least one of its bounds is not NULL
+func (a *BunAdapter) scopeWindowed(query bun.QueryBuilder) bun.QueryBuilder {
+	switch {
+	case a.matcher.ValidFrom != "" && a.matcher.ValidTo != "":
+		return query.Where("(? IS NOT NULL OR ? IS NOT NULL)", bun.Name(a.matcher.ValidFrom), bun.Name(a.matcher.ValidTo))
+	case a.matcher.ValidFrom != "":
+		return query.Where("? IS NOT NULL", bun.Name(a.matcher.ValidFrom))
+	default:
+		return query.Where("? IS NOT NULL", bun.Name(a.matcher.ValidTo))
+	}
+}
+
+// validAt checks validity window of trigger payload. Missing bound means unbounded
+func (cp CasbinPolicy) validAt(now time.Time) bool {
+	if cp.ValidFrom != nil && cp.ValidFrom.After(now) {
+		return false
+	}
+	if cp.ValidTo != nil && !cp.ValidTo.After(now) {
+		return false
+	}
+	return true
+}
+
+// validityValues maps validity window to columns. Zero time is stored as NULL (unbounded)
+func (a *BunAdapter) validityValues(validFrom, validTo time.Time) (map[string]interface{}, error) {
+	if !validFrom.IsZero() && !validTo.IsZero() && !validTo.After(validFrom) {
+		return nil, errors.Errorf("Validity window is empty: valid from %s to %s", validFrom, validTo)
+	}
+	values := map[string]interface{}{}
+	for _, bound := range []struct {
+		field  string
+		column string
+		value  time.Time
+	}{
+		{"MatcherOptions.ValidFrom", a.matcher.ValidFrom, validFrom},
+		{"MatcherOptions.ValidTo", a.matcher.ValidTo, validTo},
+	} {
+		switch {
+		case bound.column == "" && !bound.value.IsZero():
+			return nil, errors.Wrapf(ErrValidityNotSet, "Column %s is not set", bound.field)
+		case bound.column == "":
+		case bound.value.IsZero():
+			values[bound.column] = nil
+		default:
+			values[bound.column] = bound.value.UTC()
+		}
+	}
+	return values, nil
+}
+
+// AddPolicyWithExpiry adds a policy rule which is valid until the time. MatcherOptions.ValidTo column must be set.
+// See AddPolicyWithValidity()
+func (a *BunAdapter) AddPolicyWithExpiry(ctx context.Context, sec string, ptype string, rule []string, expiresAt time.Time) error {
+	return a.AddPolicyWithValidity(ctx, sec, ptype, rule, time.Time{}, expiresAt)
+}
+
+// AddPolicyWithValidity adds a policy rule which is valid within the window. Zero time means unbounded side of the window.
+// If the rule exists already its window is replaced. Table is picked by resolver (see WithSchemaResolver()) if any.
+// Enforcers receive the rule when it becomes valid and lose it when it expires via NewValidityScheduler()
+func (a *BunAdapter) AddPolicyWithValidity(ctx context.Context, sec string, ptype string, rule []string, validFrom, validTo time.Time) error {
+	a, err := a.resolveTarget(ctx)
+	if err != nil {
+		return err
+	}
+	window, err := a.validityValues(validFrom, validTo)
+	if err != nil {
+		return err
+	}
+	policy := NewCasbinPolicyFrom(ptype, rule)
+	values := a.insertValues(ctx, policy)
+	for column, value := range window {
+		values[column] = value
+	}
+	return a.runVersionedTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		inserted, err := a.insertPolicyIgnoringDuplicates(ctx, tx, values)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			return a.recordHistory(ctx, tx, POLICY_OPERATION_INSERT, []CasbinPolicy{policy})
+		}
+		/* Replace window of existing rule */
+		updated := a.updateValues(ctx, policy)
+		for column, value := range window {
+			updated[column] = value
+		}
+		query := tx.NewUpdate().
+			ModelTableExpr("?", a.policyTable())
+		for _, column := range a.insertedColumns(updated) {
+			query = query.Set("? = ?", bun.Name(column), updated[column])
+		}
+		res, err := query.
+			ApplyQueryBuilder(a.policyFilter(policy)).
+			ApplyQueryBuilder(a.scopeTenant).
+			ApplyQueryBuilder(a.scopeLive).
+			Exec(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "Can't update validity window of single policy. Policy: %+v", policy)
+		}
+		err = countChanges(ctx, res)
+		if err != nil {
+			return err
+		}
+		return a.writeHistory(ctx, tx, POLICY_OPERATION_UPDATE, []historyEntry{{old: &policy, new: &policy}})
+	})
+}
+
+// savePoliciesIncrementally makes rules valid now equal to the policies. Unlike clearing the table it keeps validity windows
+// of rules which are not changed, rules which are not valid yet, expired ones and soft-deleted ones (see MatcherOptions.DeletedAt)
+func (a *BunAdapter) savePoliciesIncrementally(ctx context.Context, tx bun.Tx, policies []CasbinPolicy) error {
+	previous, err := a.selectPoliciesWhere(ctx, tx, a.scopeValidity(time.Now().UTC()))
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]struct{}, len(previous))
+	wanted := make(map[string]struct{}, len(policies))
+	for _, policy := range policies {
+		wanted[policyKey(policy)] = struct{}{}
+	}
+	for _, policy := range previous {
+		key := policyKey(policy)
+		existing[key] = struct{}{}
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		err = a.removeRows(ctx, tx, a.policyFilter(policy))
+		if err != nil {
+			return errors.Wrapf(err, "Can't delete single policy. Policy: %+v", policy)
+		}
+	}
+	for _, policy := range policies {
+		if _, ok := existing[policyKey(policy)]; ok {
+			continue
+		}
+		// The rule could be stored with window which is not valid now or be soft-deleted
+		err = a.deleteExactPolicy(ctx, tx, policy)
+		if err != nil {
+			return err
+		}
+		values := a.insertValues(ctx, policy)
+		res, err := tx.NewInsert().
+			ModelTableExpr("?", a.policyTable()).
+			Model(&values).
+			Exec(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "Can't insert single policy. Policy: %+v", policy)
+		}
+		err = countChanges(ctx, res)
+		if err != nil {
+			return err
+		}
+	}
+	return a.recordStateChange(ctx, tx, previous, policies)
+}
+
+// deleteExactPolicy removes the rule of current tenant without recording history. Soft-deleted row is removed too
+func (a *BunAdapter) deleteExactPolicy(ctx context.Context, tx bun.Tx, policy CasbinPolicy) error {
+	_, err := tx.NewDelete().
+		ModelTableExpr("?", a.policyTable()).
+		ApplyQueryBuilder(a.policyFilter(policy)).
+		ApplyQueryBuilder(a.scopeTenant).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "Can't delete single policy. Policy: %+v", policy)
+	}
+	return nil
+}
+
+// purgeInvalid removes copy of the rule which is expired or not valid yet, so the rule inserted instead of it is not skipped as duplicate
+func (a *BunAdapter) purgeInvalid(ctx context.Context, tx bun.Tx, values map[string]interface{}) error {
+	if !a.hasValidity() {
+		return nil
+	}
+	now := time.Now().UTC()
+	query := tx.NewDelete().
+		ModelTableExpr("?", a.policyTable()).
+		WhereGroup(" AND ", func(query *bun.DeleteQuery) *bun.DeleteQuery {
+			if a.matcher.ValidFrom != "" {
+				query = query.WhereOr("? > ?", bun.Name(a.matcher.ValidFrom), now)
+			}
+			if a.matcher.ValidTo != "" {
+				query = query.WhereOr("? <= ?", bun.Name(a.matcher.ValidTo), now)
+			}
+			return query
+		})
+	for _, column := range a.ruleColumns() {
+		query = query.Where("? = ?", bun.Name(column), values[column])
+	}
+	_, err := query.Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Can't remove expired copy of policy")
+	}
+	return nil
+}
+
+// ValiditySchedulerOptions is for NewValidityScheduler()
+type ValiditySchedulerOptions struct {
+	// Maximum time between checks. Scheduler wakes up at the nearest start or end of validity window known at the previous check.
+	// Windows added or changed after it (via adapter or bypassing it) are noticed by the next check, so they could be applied up to the interval late
+	Interval time.Duration
+}
+
+// validityScheduler compares rules with validity window which are valid now with the previous state and emits the difference as change events
+type validityScheduler struct {
+	adapter *BunAdapter
+	opts    ValiditySchedulerOptions
+	state   map[string]CasbinPolicy
+}
+
+// NewValidityScheduler returns change source which emits INSERT event when rule with validity window becomes valid
+// and DELETE event when it expires. Use it along with another change source (e.g. NotifySource()), since other changes are not reported.
+// Enforcers receiving the events should not use AutoSave, otherwise expired rules are removed from the table
+func (a *BunAdapter) NewValidityScheduler(opts ValiditySchedulerOptions) ChangeSource {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultValiditySchedulerOpts.Interval
+	}
+	return &validityScheduler{
+		adapter: a,
+		opts:    opts,
+	}
+}
+
+// Run checks validity windows until ctx is done or error occurs. Initial state is read on start and it does not produce events
+func (src *validityScheduler) Run(ctx context.Context, events chan<- TriggerDataPayload) error {
+	if !src.adapter.hasValidity() {
+		return errors.Wrap(ErrValidityNotSet, "Scheduler requires MatcherOptions.ValidFrom or MatcherOptions.ValidTo column")
+	}
+	_, next, err := src.check(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		wait := src.opts.Interval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		var changes []TriggerDataPayload
+		changes, next, err = src.check(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, payload := range changes {
+			select {
+			case <-ctx.Done():
+				return nil
+			case events <- payload:
+			}
+		}
+	}
+}
+
+// check reads rules with validity window which are valid now and returns difference with the previous state along with the nearest bound of windows
+func (src *validityScheduler) check(ctx context.Context) ([]TriggerDataPayload, time.Time, error) {
+	a := src.adapter
+	now := time.Now().UTC()
+	var rows []CasbinPolicy
+	var next time.Time
+	err := a.runRead(ctx, func(ctx context.Context, db bun.IDB) error {
+		var err error
+		valid := a.scopeValidity(now)
+		rows, err = a.selectPoliciesWhere(ctx, db, func(query bun.QueryBuilder) bun.QueryBuilder {
+			return valid(a.scopeWindowed(query))
+		})
+		if err != nil {
+			return err
+		}
+		next, err = a.nextValidityBound(ctx, db, now)
+		return err
+	})
+	if err != nil {
+		return nil, time.Time{}, errors.Wrap(err, "Can't check validity of policies")
+	}
+	state := policyState(rows)
+	var changes []TriggerDataPayload
+	if src.state != nil {
+		changes = diffPolicyStates(src.state, state)
+	}
+	src.state = state
+	return changes, next, nil
+}
+
+// nextValidityBound returns the nearest start or end of validity window after the time. Zero time means that there is no such bound
+func (a *BunAdapter) nextValidityBound(ctx context.Context, db bun.IDB, now time.Time) (time.Time, error) {
+	var next time.Time
+	for _, column := range []string{a.matcher.ValidFrom, a.matcher.ValidTo} {
+		if column == "" {
+			continue
+		}
+		var bound bun.NullTime
+		err := db.NewSelect().
+			ModelTableExpr("? as t", a.policyTable()).
+			ColumnExpr("MIN(?)", bun.Name(column)).
+			Where("? > ?", bun.Name(column), now).
+			ApplyQueryBuilder(a.scopeTenant).
+			ApplyQueryBuilder(a.scopeLive).
+			Scan(ctx, &bound)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !bound.IsZero() && (next.IsZero() || bound.Before(next)) {
+			next = bound.Time
+		}
+	}
+	return next, nil
+}
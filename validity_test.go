@@ -0,0 +1,148 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// go test -run '^TestValidityWindow$' *.go -v
+func TestValidityWindow(t *testing.T) {
+	matcher := MatcherOptions{TableName: "validity_policies", ValidFrom: "valid_from", ValidTo: "valid_to"}
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(matcher))
+	ctx := context.Background()
+	report, err := adapter.IntrospectTable(ctx)
+	assert.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+
+	now := time.Now()
+	assert.NoError(t, adapter.AddPolicy("p", "p", []string{"alice", "data1", "read", "allow"}))
+	assert.NoError(t, adapter.AddPolicyWithExpiry(ctx, "p", "p", []string{"bob", "data1", "read", "allow"}, now.Add(time.Hour)))
+	assert.NoError(t, adapter.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data1", "read", "allow"}, now.Add(-time.Hour)))
+	assert.NoError(t, adapter.AddPolicyWithValidity(ctx, "p", "p", []string{"dave", "data1", "read", "allow"}, now.Add(time.Hour), time.Time{}))
+
+	enforcer := newTestEnforcerWithAdapter(t, adapter)
+	policies, err := enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"alice", "data1", "read", "allow"}, {"bob", "data1", "read", "allow"}}, policies)
+
+	records, err := adapter.ListPolicies(ctx, ListFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 4) {
+		assert.Nil(t, records[0].ValidTo)
+		if assert.NotNil(t, records[1].ValidTo) {
+			assert.WithinDuration(t, now.Add(time.Hour), *records[1].ValidTo, time.Second)
+		}
+	}
+
+	/* Existing rule gets new window */
+	assert.NoError(t, adapter.AddPolicyWithExpiry(ctx, "p", "p", []string{"carol", "data1", "read", "allow"}, now.Add(time.Hour)))
+	enforcer = newTestEnforcerWithAdapter(t, adapter)
+	policies, err = enforcer.GetPolicy()
+	assert.NoError(t, err)
+	assert.Len(t, policies, 3)
+
+	/* SavePolicy keeps windows */
+	_, err = enforcer.RemovePolicy("alice", "data1", "read", "allow")
+	assert.NoError(t, err)
+	assert.NoError(t, enforcer.SavePolicy())
+	records, err = adapter.ListPolicies(ctx, ListFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	for _, record := range records {
+		assert.NotEqual(t, "alice", record.Rule[0])
+		if record.Rule[0] == "dave" {
+			assert.NotNil(t, record.ValidFrom)
+		}
+	}
+
+	/* Adding rule replaces its copy which is expired or not valid yet */
+	assert.NoError(t, adapter.AddPolicyWithExpiry(ctx, "p", "p", []string{"frank", "data2", "read", "allow"}, now.Add(-time.Minute)))
+	assert.NoError(t, adapter.AddPolicyWithValidity(ctx, "p", "p", []string{"grace", "data2", "read", "allow"}, now.Add(time.Hour), time.Time{}))
+	enforcer = newTestEnforcerWithAdapter(t, adapter)
+	for _, user := range []string{"frank", "grace"} {
+		added, err := enforcer.AddPolicy(user, "data2", "read", "allow")
+		assert.NoError(t, err)
+		assert.True(t, added)
+	}
+	assert.NoError(t, enforcer.LoadPolicy())
+	policies, err = enforcer.GetFilteredPolicy(1, "data2")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{"frank", "data2", "read", "allow"}, {"grace", "data2", "read", "allow"}}, policies)
+	records, err = adapter.ListPolicies(ctx, ListFilter{})
+	assert.NoError(t, err)
+	for _, record := range records {
+		if record.Rule[1] == "data2" {
+			assert.Nil(t, record.ValidFrom)
+			assert.Nil(t, record.ValidTo)
+		}
+	}
+
+	assert.Error(t, adapter.AddPolicyWithValidity(ctx, "p", "p", []string{"eve"}, now, now.Add(-time.Hour)))
+	plain := newSQLiteAdapter(t, WithMatcherOptions(MatcherOptions{TableName: "validity_plain_policies"}))
+	assert.ErrorIs(t, plain.AddPolicyWithExpiry(ctx, "p", "p", []string{"eve"}, now), ErrValidityNotSet)
+}
+
+// go test -run '^TestValidityScheduler$' *.go -v
+func TestValidityScheduler(t *testing.T) {
+	matcher := MatcherOptions{TableName: "scheduled_policies", ValidFrom: "valid_from", ValidTo: "valid_to"}
+	adapter := newSQLiteAdapter(t, WithMatcherOptions(matcher))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	bob := NewCasbinPolicyFrom("p", []string{"bob", "data1", "read", "allow"})
+	carol := NewCasbinPolicyFrom("p", []string{"carol", "data1", "read", "allow"})
+	assert.NoError(t, adapter.AddPolicyWithExpiry(ctx, "p", bob.PType, bob.getRuleDefinition(), now.Add(300*time.Millisecond)))
+	assert.NoError(t, adapter.AddPolicyWithValidity(ctx, "p", carol.PType, carol.getRuleDefinition(), now.Add(150*time.Millisecond), time.Time{}))
+
+	// Interval is long, so events are caused by bounds of windows only
+	source := adapter.NewValidityScheduler(ValiditySchedulerOptions{Interval: time.Hour})
+	events := make(chan TriggerDataPayload)
+	done := make(chan error, 1)
+	go func() {
+		done <- source.Run(ctx, events)
+	}()
+
+	received := []TriggerDataPayload{}
+	for len(received) < 2 {
+		select {
+		case payload := <-events:
+			received = append(received, payload)
+		case <-ctx.Done():
+			t.Fatal("Timeout waiting for scheduler events")
+		}
+	}
+	assert.Equal(t, EVENT_PAYLOAD_INSERT, received[0].EventType)
+	assert.Equal(t, "carol", received[0].New.V0)
+	assert.Equal(t, EVENT_PAYLOAD_DELETE, received[1].EventType)
+	assert.Equal(t, "bob", received[1].Old.V0)
+	cancel()
+	assert.NoError(t, <-done)
+
+	plain := NewBunAdapter(adapter.DB)
+	assert.ErrorIs(t, plain.NewValidityScheduler(ValiditySchedulerOptions{}).Run(context.Background(), events), ErrValidityNotSet)
+}
+
+// go test -run '^TestScopePayloadValidity$' *.go -v
+func TestScopePayloadValidity(t *testing.T) {
+	adapter := newDialectAdapter(pgdialect.New(), WithMatcherOptions(MatcherOptions{ValidTo: "valid_to"}))
+	statements, err := adapter.TriggerSQL()
+	assert.NoError(t, err)
+	assert.Contains(t, statements.Function, `'valid_to', new."valid_to"::timestamptz`)
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	expired := CasbinPolicy{PType: "p", V0: "bob", ValidTo: &past}
+	valid := CasbinPolicy{PType: "p", V0: "bob", ValidTo: &future}
+
+	_, ok := adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: expired})
+	assert.False(t, ok)
+	_, ok = adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_INSERT, New: valid})
+	assert.True(t, ok)
+	payload, ok := adapter.scopePayload(TriggerDataPayload{EventType: EVENT_PAYLOAD_UPDATE, Old: valid, New: expired})
+	assert.True(t, ok)
+	assert.Equal(t, EVENT_PAYLOAD_DELETE, payload.EventType)
+}
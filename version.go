@@ -0,0 +1,145 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect"
+)
+
+// versionSettingName is transaction-local PostgreSQL setting where trigger function stores version of the latest change
+const versionSettingName = "casbin.policy_version"
+
+// versionTracker keeps the highest seen policy version and wakes up goroutines waiting for it
+type versionTracker struct {
+	mu      sync.Mutex
+	current int64
+	changed chan struct{}
+}
+
+func newVersionTracker() *versionTracker {
+	return &versionTracker{
+		changed: make(chan struct{}),
+	}
+}
+
+func (t *versionTracker) load() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// advance moves version forward. Lower or equal versions are ignored
+func (t *versionTracker) advance(version int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if version <= t.current {
+		return
+	}
+	t.current = version
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// wait blocks until version reaches given value or context is done
+func (t *versionTracker) wait(ctx context.Context, version int64) error {
+	for {
+		t.mu.Lock()
+		if t.current >= version {
+			t.mu.Unlock()
+			return nil
+		}
+		changed := t.changed
+		t.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// AppliedVersion returns version of the latest change applied by the updates listener of this adapter
+func (a *BunAdapter) AppliedVersion() int64 {
+	return a.applied.load()
+}
+
+// WaitForVersion blocks until the updates listener of this adapter applies change with given version (or newer one).
+// Use it along with LastWrittenVersion() of writer side to get read-your-writes behaviour.
+func (a *BunAdapter) WaitForVersion(ctx context.Context, version int64) error {
+	return a.applied.wait(ctx, version)
+}
+
+// LastWrittenVersion returns version of the latest change committed via this adapter (AddPolicy, RemovePolicy and etc.).
+// It is zero if trigger has not been prepared by PrepareTrigger() (and revision table is disabled) or nothing has been written yet
+func (a *BunAdapter) LastWrittenVersion() int64 {
+	return a.written.load()
+}
+
+// txChangesKey is context key of counter of rows changed within versioned transaction. See countChanges()
+type txChangesKey struct{}
+
+// countChanges adds number of rows affected by the statement to the counter of versioned transaction (see runVersionedTx())
+func countChanges(ctx context.Context, res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	markChanged(ctx, affected)
+	return nil
+}
+
+// markChanged adds number of changed rows to the counter of versioned transaction. It does nothing outside of versioned transaction
+func markChanged(ctx context.Context, rows int64) {
+	if counter, ok := ctx.Value(txChangesKey{}).(*int64); ok {
+		*counter += rows
+	}
+}
+
+// runVersionedTx executes fn in transaction and remembers policy version assigned to the change by the trigger function.
+// If revision table is enabled then its revision is bumped and used as version instead. Revision is not bumped when fn has not changed any row
+// (writes must be reported via countChanges())
+func (a *BunAdapter) runVersionedTx(ctx context.Context, fn func(ctx context.Context, tx bun.Tx) error) error {
+	var version sql.NullString
+	var changed int64
+	ctx = context.WithValue(ctx, txChangesKey{}, &changed)
+	err := a.runTx(ctx, func(ctx context.Context, tx bun.Tx) error {
+		err := fn(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if a.revisionTable != "" {
+			if changed == 0 {
+				return nil
+			}
+			revision, err := a.bumpRevision(ctx, tx)
+			if err != nil {
+				return err
+			}
+			version = sql.NullString{String: strconv.FormatInt(revision, 10), Valid: true}
+			return nil
+		}
+		if a.dialectName() != dialect.PG {
+			// Triggers are available for PostgreSQL only
+			return nil
+		}
+		return tx.QueryRowContext(ctx, "SELECT current_setting(?, true)", versionSettingName).Scan(&version)
+	})
+	if err != nil {
+		return err
+	}
+	if !version.Valid || version.String == "" {
+		// Trigger is not installed or nothing has been changed
+		return nil
+	}
+	parsed, err := strconv.ParseInt(version.String, 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "Can't parse policy version '%s'", version.String)
+	}
+	a.written.advance(parsed)
+	return nil
+}
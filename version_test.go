@@ -0,0 +1,37 @@
+package casbinbunadapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// go test -run '^TestVersionTracker$' *.go -v
+func TestVersionTracker(t *testing.T) {
+	tracker := newVersionTracker()
+	tracker.advance(3)
+	tracker.advance(2) // Must be ignored
+	assert.Equal(t, int64(3), tracker.load())
+
+	// Already reached version must not block
+	assert.NoError(t, tracker.wait(context.Background(), 3))
+
+	done := make(chan error)
+	go func() {
+		done <- tracker.wait(context.Background(), 5)
+	}()
+	tracker.advance(4)
+	select {
+	case <-done:
+		t.Fatal("Wait must not return before version 5 is reached")
+	case <-time.After(20 * time.Millisecond):
+	}
+	tracker.advance(6)
+	assert.NoError(t, <-done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, tracker.wait(ctx, 10), context.DeadlineExceeded)
+}